@@ -2,24 +2,32 @@ package cmd
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/laetificat/slogger/pkg/slogger"
 
+	"github.com/laetificat/pricewatcher/internal/account"
 	"github.com/laetificat/pricewatcher/internal/helper"
+	"github.com/laetificat/pricewatcher/internal/model"
 	"github.com/laetificat/pricewatcher/internal/watcher"
 	"github.com/spf13/cobra"
 )
 
 var (
-	domain string
-	addCmd = &cobra.Command{
-		Use:   "add",
-		Short: "Add a new price watcher",
-		Long:  `Add a new price watcher to keep an eye on a price.`,
+	domain      string
+	below       string
+	dropPercent float32
+	dropFromLow float32
+	alertNewLow bool
+	addTags     []string
+	addForUser  string
+	addCmd      = &cobra.Command{
+		Use:         "add",
+		Short:       "Add a new price watcher",
+		Long:        `Add a new price watcher to keep an eye on a price.`,
+		Annotations: map[string]string{annotationUseAPI: "true"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				if err := addDomain(args[0], domain); err != nil {
+				if err := addDomain(args[0], domain, alertRulesFromFlags(), addTags, addForUser); err != nil {
 					slogger.Fatal(err.Error())
 				}
 			} else {
@@ -31,26 +39,78 @@ var (
 
 func registerAddCmd() {
 	addCmd.PersistentFlags().StringVar(&domain, "domain", "", "define the domain, for example: bol.com, ebay.nl, coolblue.nl, etc")
+	addCmd.PersistentFlags().StringVar(&below, "below", "", "alert when the price drops below this amount, for example 99.95")
+	addCmd.PersistentFlags().Float32Var(&dropPercent, "drop-percent", 0, "alert when the price drops this percentage from the last price")
+	addCmd.PersistentFlags().Float32Var(&dropFromLow, "drop-from-low", 0, "alert when the price drops this percentage below the all-time low")
+	addCmd.PersistentFlags().BoolVar(&alertNewLow, "new-low", false, "alert when the price is a new all-time low")
+	addCmd.PersistentFlags().StringSliceVar(&addTags, "tag", nil, "add a tag to the watcher, can be repeated or a comma separated list")
+	addCmd.PersistentFlags().StringVar(&addForUser, "user", "", "subscribe this user to the watcher, an existing watcher of the URL is shared")
 
 	rootCmd.AddCommand(addCmd)
 }
 
-func addDomain(url, domain string) error {
-	if domain == "" {
-		var err error
-		domain, err = helper.GuessDomain(url)
-		if err != nil {
-			if strings.EqualFold(helper.NoSupportedDomainFoundErrorMessage, err.Error()) {
-				slogger.Info(fmt.Sprintf("Domain '%s' is not supported", domain))
-			}
+/*
+addDomain adds a watcher for the url, a watcher for a user subscribes the user to the existing watcher of the url when
+there is one.
+*/
+func addDomain(url, domain string, alertRules []model.AlertRule, tags []string, user string) error {
+	domain, err := helper.ResolveDomain(url, domain)
+	if err != nil {
+		return err
+	}
+
+	if !helper.IsSupported(domain) {
+		slogger.Info(fmt.Sprintf("Domain '%s' has no extraction rules, the price is taken from the structured data of the page", domain))
+	}
+
+	newWatcher := &model.Watcher{URL: url, Domain: domain, AlertRules: alertRules, Tags: tags}
+	if webserverAPI != nil {
+		if user != "" {
+			return fmt.Errorf("--user needs the database, add the watcher through the API with the token of the user instead")
 		}
+
+		return webserverAPI.createWatcher(newWatcher)
 	}
 
-	if helper.IsSupported(domain) {
-		return watcher.Add(domain, url)
+	if user == "" {
+		return watcher.Create(watcherStore, newWatcher)
 	}
 
-	slogger.Info(fmt.Sprintf("Domain '%s' is not supported", domain))
+	subscriber, err := account.Get(watcherStore, user)
+	if err != nil {
+		return userError(user, err)
+	}
 
+	shared, created, err := watcher.CreateFor(watcherStore, subscriber.Name, newWatcher)
+	if err != nil || created {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Subscribed user '%s' to the existing watcher %d", subscriber.Name, shared.ID))
 	return nil
 }
+
+/*
+alertRulesFromFlags returns the alert rules for the alert flags that are set.
+*/
+func alertRulesFromFlags() []model.AlertRule {
+	var alertRules []model.AlertRule
+
+	if below != "" {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertBelow, Amount: below})
+	}
+
+	if dropPercent > 0 {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertDropPercent, Value: dropPercent})
+	}
+
+	if dropFromLow > 0 {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertDropFromLow, Value: dropFromLow})
+	}
+
+	if alertNewLow {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertNewLow})
+	}
+
+	return alertRules
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+)
+
+// apiClient uses the v2 API of the running webserver with the admin.token from the config, the watcher commands use it
+// instead of the database when the webserver has the bolt database open.
+type apiClient struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// webserverAPI is set instead of watcherStore when the watcher commands go through the API of the webserver.
+var webserverAPI *apiClient
+
+/*
+newAPIClient returns a client for the API of the webserver on the given address.
+*/
+func newAPIClient(address, token string) *apiClient {
+	return &apiClient{address: address, token: token, client: &http.Client{}}
+}
+
+/*
+createWatcher creates the watcher, an existing watcher for its URL is an error like it is for the database.
+*/
+func (c *apiClient) createWatcher(newWatcher *model.Watcher) error {
+	input := map[string]interface{}{"url": newWatcher.URL, "domain": newWatcher.Domain}
+	if newWatcher.AlertRules != nil {
+		input["alert_rules"] = newWatcher.AlertRules
+	}
+	if newWatcher.Tags != nil {
+		input["tags"] = newWatcher.Tags
+	}
+
+	return c.do(http.MethodPost, "/v2/watchers", input, newWatcher)
+}
+
+/*
+getWatcher returns the watcher with the given ID, with its price history when includeHistory is true.
+*/
+func (c *apiClient) getWatcher(id int, includeHistory bool) (*model.Watcher, error) {
+	found := &model.Watcher{}
+	path := fmt.Sprintf("/v2/watchers/%d?history=%t", id, includeHistory)
+
+	return found, c.do(http.MethodGet, path, nil, found)
+}
+
+/*
+listWatchers returns a page of the watchers that match the query params and the cursor of the next page.
+*/
+func (c *apiClient) listWatchers(query url.Values) ([]model.Watcher, string, error) {
+	page := struct {
+		Watchers   []model.Watcher `json:"watchers"`
+		NextCursor string          `json:"next_cursor"`
+	}{}
+
+	err := c.do(http.MethodGet, "/v2/watchers?"+query.Encode(), nil, &page)
+	return page.Watchers, page.NextCursor, err
+}
+
+/*
+editWatcher makes the changes to the name, URL and domain of the watcher with the given ID and returns the changed
+watcher.
+*/
+func (c *apiClient) editWatcher(id int, changes watcher.Changes) (*model.Watcher, error) {
+	input := map[string]interface{}{}
+	if changes.Name != nil {
+		input["name"] = *changes.Name
+	}
+	if changes.URL != nil {
+		input["url"] = *changes.URL
+	}
+	if changes.Domain != nil {
+		input["domain"] = *changes.Domain
+	}
+
+	edited := &model.Watcher{}
+	return edited, c.do(http.MethodPatch, fmt.Sprintf("/v2/watchers/%d", id), input, edited)
+}
+
+/*
+editTags adds and removes the tags of the watcher with the given ID and returns the changed watcher.
+*/
+func (c *apiClient) editTags(id int, add, remove []string) (*model.Watcher, error) {
+	if len(add) > 0 {
+		input := map[string]interface{}{"tags": add}
+		if err := c.do(http.MethodPost, fmt.Sprintf("/v2/watchers/%d/tags", id), input, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tag := range remove {
+		if err := c.do(http.MethodDelete, fmt.Sprintf("/v2/watchers/%d/tags/%s", id, url.PathEscape(tag)), nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.getWatcher(id, false)
+}
+
+/*
+removeWatcher removes the watcher with the given ID.
+*/
+func (c *apiClient) removeWatcher(id int) error {
+	return c.do(http.MethodDelete, "/v2/watchers/"+strconv.Itoa(id), nil, nil)
+}
+
+/*
+removeAll removes all the watchers page by page.
+*/
+func (c *apiClient) removeAll() error {
+	for {
+		watchers, _, err := c.listWatchers(url.Values{})
+		if err != nil {
+			return err
+		}
+
+		if len(watchers) == 0 {
+			return nil
+		}
+
+		for _, w := range watchers {
+			if err := c.removeWatcher(w.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+/*
+do sends the request with the body as JSON and decodes the JSON response into the target, a nil target ignores the
+response. The message of an error response is returned as the error.
+*/
+func (c *apiClient) do(method, path string, body, target interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.address+path, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("the database is in use and the webserver can not be reached: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		response := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil || response.Error.Message == "" {
+			return fmt.Errorf("%s %s failed, status code %d", method, path, res.StatusCode)
+		}
+
+		return errors.New(response.Error.Message)
+	}
+
+	if target == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(target)
+}
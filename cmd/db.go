@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/laetificat/pricewatcher/internal/migration"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	dryRun       bool
+	copyFrom     string
+	copyTo       string
+	fromFile     string
+	toFile       string
+	remoteBackup bool
+	dbCmd        = &cobra.Command{
+		Use:         "db",
+		Short:       "Manage the watcher database",
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+	}
+	dbMigrateCmd = &cobra.Command{
+		Use:         "migrate",
+		Short:       "Apply the pending database migrations",
+		Long:        `Apply the pending database migrations, the database is backed up next to the database file first.`,
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := migrate(dryRun); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	dbCopyCmd = &cobra.Command{
+		Use:   "copy",
+		Short: "Copy the watchers to another database",
+		Long: `Copy the watchers with their price histories and the exchange rates from one database to another, for example
+from bolt to sqlite. The watchers keep their IDs, so the database to copy to can not have any watchers.`,
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := copyDatabase(copyFrom, fromFile, copyTo, toFile); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	dbBackupCmd = &cobra.Command{
+		Use:   "backup <file>",
+		Short: "Back up the watcher database",
+		Long: `Write a consistent snapshot of the watcher database to the file. A bolt database can not be opened while the
+webserver runs, use --remote to download the snapshot from the running webserver instead.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := backupDatabase(args[0], remoteBackup); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	dbRestoreCmd = &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the watcher database from a backup",
+		Long: `Replace the watcher database with the backup in the file, the backup is checked first and the replaced database
+is kept next to the database file. Stop the webserver before restoring.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := restoreDatabase(args[0]); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	dbCompactCmd = &cobra.Command{
+		Use:   "compact",
+		Short: "Reclaim the unused space in the watcher database",
+		Long: `Rewrite the watcher database to reclaim the space of removed watchers and prices. Stop the webserver before
+compacting a bolt database.`,
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := compactDatabase(); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+)
+
+func registerDbCmd() {
+	dbMigrateCmd.PersistentFlags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"show the pending migrations and check if they succeed without changing the database",
+	)
+
+	dbCopyCmd.PersistentFlags().StringVar(
+		&copyFrom,
+		"from",
+		"",
+		"the driver of the database to copy from, bolt or sqlite (default is database.driver)",
+	)
+	dbCopyCmd.PersistentFlags().StringVar(&fromFile, "from-file", "", "the database file to copy from (default is the database file)")
+	dbCopyCmd.PersistentFlags().StringVar(&copyTo, "to", "", "the driver of the database to copy to, bolt or sqlite")
+	dbCopyCmd.PersistentFlags().StringVar(&toFile, "to-file", "", "the database file to copy to")
+
+	dbBackupCmd.PersistentFlags().BoolVar(
+		&remoteBackup,
+		"remote",
+		false,
+		"download the snapshot from GET /admin/backup of the running webserver",
+	)
+
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbCopyCmd)
+	dbCmd.AddCommand(dbBackupCmd)
+	dbCmd.AddCommand(dbRestoreCmd)
+	dbCmd.AddCommand(dbCompactCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+/*
+migrate applies the pending migrations, or only checks them for a dry run.
+*/
+func migrate(dryRun bool) error {
+	if driver := viper.GetString("database.driver"); driver != store.DriverBolt {
+		// The SQLite schema is created and upgraded when the database is opened.
+		s, err := store.Open(driver, viper.GetString("database_file"), viper.GetDuration("database.timeout"))
+		if err != nil {
+			return err
+		}
+
+		slogger.Info(fmt.Sprintf("The %s database is up to date", driver))
+		return s.Close()
+	}
+
+	result, err := migration.Migrate(viper.GetString("database_file"), viper.GetDuration("database.timeout"), dryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Applied) == 0 {
+		slogger.Info(fmt.Sprintf("The database is up to date, schema version %d", result.To))
+		return nil
+	}
+
+	for _, m := range result.Applied {
+		if dryRun {
+			slogger.Info(fmt.Sprintf("Would apply migration %d: %s", m.Version, m.Description))
+		} else {
+			slogger.Info(fmt.Sprintf("Applied migration %d: %s", m.Version, m.Description))
+		}
+	}
+
+	if dryRun {
+		slogger.Info(fmt.Sprintf("The migrations from schema version %d to %d succeed, nothing was changed", result.From, result.To))
+		return nil
+	}
+
+	slogger.Info(fmt.Sprintf("Backed up the database to '%s', migrated from schema version %d to %d", result.Backup, result.From, result.To))
+	return nil
+}
+
+/*
+copyDatabase copies the watchers from one database to another, an empty driver or from file is the configured database.
+*/
+func copyDatabase(fromDriver, fromPath, toDriver, toPath string) error {
+	if fromDriver == "" {
+		fromDriver = viper.GetString("database.driver")
+	}
+
+	if fromPath == "" {
+		fromPath = viper.GetString("database_file")
+	}
+
+	if toDriver == "" || toPath == "" {
+		return fmt.Errorf("give the database to copy to with --to and --to-file")
+	}
+
+	if fromPath == toPath {
+		return fmt.Errorf("can not copy the database '%s' to itself", fromPath)
+	}
+
+	from, err := openStore(fromDriver, fromPath)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	to, err := openStore(toDriver, toPath)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+
+	copied, err := store.Copy(from, to)
+	if err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Copied %d watcher(s) from %s '%s' to %s '%s'", copied, fromDriver, fromPath, toDriver, toPath))
+	return nil
+}
+
+/*
+backupDatabase writes a snapshot of the watcher database to the file, from the database itself or from the running
+webserver. The file only appears when the whole snapshot was written.
+*/
+func backupDatabase(path string, remote bool) error {
+	var write func(w io.Writer) (int64, error)
+
+	if remote {
+		write = func(w io.Writer) (int64, error) {
+			return downloadBackup(viper.GetString("webserver.address"), viper.GetString("admin.token"), w)
+		}
+	} else {
+		s, err := openStore(viper.GetString("database.driver"), viper.GetString("database_file"))
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		write = s.Backup
+	}
+
+	partial := path + ".partial"
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	written, err := write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+
+	if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Backed up the database to '%s', %d bytes", path, written))
+	return nil
+}
+
+/*
+downloadBackup writes the snapshot from the admin backup endpoint of the webserver on the given address to the writer.
+*/
+func downloadBackup(address, token string, w io.Writer) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, address+"/admin/backup", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("downloading the backup failed, status code %d", res.StatusCode)
+	}
+
+	return io.Copy(w, res.Body)
+}
+
+/*
+restoreDatabase checks the backup and replaces the watcher database with it.
+*/
+func restoreDatabase(backup string) error {
+	driver := viper.GetString("database.driver")
+	path := viper.GetString("database_file")
+	timeout := viper.GetDuration("database.timeout")
+
+	// The backup is checked and moved into place as a copy next to the database, so the backup itself is never changed.
+	restored := path + ".restore"
+	if err := copyFile(backup, restored); err != nil {
+		return err
+	}
+	defer os.Remove(restored)
+
+	if err := store.Check(driver, restored, timeout); err != nil {
+		return fmt.Errorf("the backup '%s' can not be restored: %s", backup, err.Error())
+	}
+
+	if driver == store.DriverBolt {
+		version, err := migration.Version(restored, timeout)
+		if err != nil {
+			return err
+		}
+
+		if version > migration.Latest() {
+			return fmt.Errorf(
+				"the backup has schema version %d, this version of pricewatcher supports up to version %d",
+				version,
+				migration.Latest(),
+			)
+		}
+	}
+
+	previous, err := store.Replace(driver, path, restored, timeout)
+	if err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Restored the database from '%s', the replaced database is kept as '%s'", backup, previous))
+	return nil
+}
+
+/*
+compactDatabase reclaims the unused space in the watcher database.
+*/
+func compactDatabase() error {
+	before, after, err := store.Compact(
+		viper.GetString("database.driver"),
+		viper.GetString("database_file"),
+		viper.GetDuration("database.timeout"),
+	)
+	if err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Compacted the database from %d to %d bytes", before, after))
+	return nil
+}
+
+/*
+copyFile copies the file at the from path to the to path.
+*/
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
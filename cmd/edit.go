@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/laetificat/pricewatcher/internal/helper"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	editURL    string
+	editName   string
+	editDomain string
+	addTag     []string
+	removeTag  []string
+	editCmd    = &cobra.Command{
+		Use:   "edit <id>",
+		Short: "Change a price watcher",
+		Long: `Changes the URL, name, domain or tags of the price watcher with the given ID, the price history is kept.
+The domain is guessed again when the URL is changed without --domain.`,
+		Annotations: map[string]string{annotationUseAPI: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			flags := cmd.Flags()
+			changesWatcher := flags.Changed("url") || flags.Changed("name") || flags.Changed("domain")
+			if len(args) == 0 || !(changesWatcher || len(addTag) > 0 || len(removeTag) > 0) {
+				_ = cmd.Help()
+				return
+			}
+
+			if len(addTag) > 0 || len(removeTag) > 0 {
+				if err := editTags(args[0], addTag, removeTag); err != nil {
+					slogger.Fatal(err.Error())
+				}
+
+				if !changesWatcher {
+					return
+				}
+			}
+
+			changes := watcher.Changes{}
+			if flags.Changed("url") {
+				changes.URL = &editURL
+			}
+			if flags.Changed("name") {
+				changes.Name = &editName
+			}
+			if flags.Changed("domain") {
+				changes.Domain = &editDomain
+			}
+
+			if err := editWatcher(args[0], changes); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+)
+
+func registerEditCmd() {
+	editCmd.PersistentFlags().StringVar(&editURL, "url", "", "the new URL of the watcher")
+	editCmd.PersistentFlags().StringVar(
+		&editName,
+		"name",
+		"",
+		"the new name of the watcher, an empty name uses the name on the product page again",
+	)
+	editCmd.PersistentFlags().StringVar(&editDomain, "domain", "", "the new domain, for example: bol.com, ebay.nl, coolblue.nl, etc")
+	editCmd.PersistentFlags().StringSliceVar(&addTag, "add-tag", nil, "add a tag, can be repeated or a comma separated list")
+	editCmd.PersistentFlags().StringSliceVar(&removeTag, "remove-tag", nil, "remove a tag, can be repeated or a comma separated list")
+
+	rootCmd.AddCommand(editCmd)
+}
+
+/*
+editWatcher makes the changes to the watcher with the given ID, the domain is resolved again when the URL changes.
+*/
+func editWatcher(id string, changes watcher.Changes) error {
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+
+	if changes.URL != nil && *changes.URL == "" {
+		return fmt.Errorf("the url can not be empty")
+	}
+
+	if changes.URL != nil || changes.Domain != nil {
+		current, err := findWatcher(idInt)
+		if err != nil {
+			if err == watcher.ErrNotFound {
+				return fmt.Errorf("no watcher found with id %d", idInt)
+			}
+
+			return err
+		}
+
+		pageURL, givenDomain := current.URL, ""
+		if changes.URL != nil {
+			pageURL = *changes.URL
+		}
+		if changes.Domain != nil {
+			givenDomain = *changes.Domain
+		}
+
+		domain, err := helper.ResolveDomain(pageURL, givenDomain)
+		if err != nil {
+			return err
+		}
+		changes.Domain = &domain
+
+		if !helper.IsSupported(domain) {
+			slogger.Info(fmt.Sprintf("Domain '%s' has no extraction rules, the price is taken from the structured data of the page", domain))
+		}
+	}
+
+	var edited *model.Watcher
+	if webserverAPI != nil {
+		edited, err = webserverAPI.editWatcher(idInt, changes)
+	} else {
+		edited, err = watcher.Edit(watcherStore, idInt, changes)
+	}
+	if err != nil {
+		if err == watcher.ErrNotFound {
+			return fmt.Errorf("no watcher found with id %d", idInt)
+		}
+
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Changed watcher %d, %s (%s)", edited.ID, edited.URL, edited.Domain))
+
+	return nil
+}
+
+/*
+editTags adds and removes the tags of the watcher with the given ID.
+*/
+func editTags(id string, add, remove []string) error {
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+
+	var edited *model.Watcher
+	if webserverAPI != nil {
+		edited, err = webserverAPI.editTags(idInt, add, remove)
+	} else {
+		if len(add) > 0 {
+			edited, err = watcher.AddTags(watcherStore, idInt, "", add)
+		}
+		if len(remove) > 0 && err == nil {
+			edited, err = watcher.RemoveTags(watcherStore, idInt, "", remove)
+		}
+	}
+	if err == watcher.ErrNotFound {
+		return fmt.Errorf("no watcher found with id %d", idInt)
+	}
+	if err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Changed the tags of watcher %d to %v", edited.ID, edited.Tags))
+
+	return nil
+}
+
+/*
+findWatcher returns the watcher with the given ID from the database, or from the API of the webserver when it has the
+database open.
+*/
+func findWatcher(id int) (*model.Watcher, error) {
+	if webserverAPI != nil {
+		return webserverAPI.getWatcher(id, false)
+	}
+
+	return watcher.Get(watcherStore, id)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getHistory bool
+	getCmd     = &cobra.Command{
+		Use:         "get <id>",
+		Short:       "Show a price watcher",
+		Long:        `Shows the price watcher with the given ID as JSON, with its price history when --history is given.`,
+		Annotations: map[string]string{annotationUseAPI: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				if err := getWatcher(args[0], getHistory, os.Stdout); err != nil {
+					slogger.Fatal(err.Error())
+				}
+			} else {
+				_ = cmd.Help()
+			}
+		},
+	}
+)
+
+func registerGetCmd() {
+	getCmd.PersistentFlags().BoolVar(&getHistory, "history", false, "include the price history")
+
+	rootCmd.AddCommand(getCmd)
+}
+
+/*
+getWatcher writes the watcher with the given ID as indented JSON to the writer.
+*/
+func getWatcher(id string, includeHistory bool, writer io.Writer) error {
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+
+	if webserverAPI != nil {
+		foundWatcher, err := webserverAPI.getWatcher(idInt, includeHistory)
+		if err != nil {
+			return err
+		}
+
+		return writeIndented(foundWatcher, writer)
+	}
+
+	foundWatcher, err := watcher.Get(watcherStore, idInt)
+	if err != nil {
+		if err == watcher.ErrNotFound {
+			return fmt.Errorf("no watcher found with id %d", idInt)
+		}
+
+		return err
+	}
+
+	if includeHistory {
+		watchers := []model.Watcher{*foundWatcher}
+		if err := watcher.LoadHistories(watcherStore, watchers); err != nil {
+			return err
+		}
+		foundWatcher = &watchers[0]
+	}
+
+	return writeIndented(foundWatcher, writer)
+}
+
+/*
+writeIndented writes the watcher as indented JSON to the writer.
+*/
+func writeIndented(foundWatcher *model.Watcher, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "    ")
+
+	return encoder.Encode(foundWatcher)
+}
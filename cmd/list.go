@@ -1,14 +1,22 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/laetificat/pricewatcher/internal/helper"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/rates"
 	"github.com/laetificat/pricewatcher/internal/watcher"
 	"github.com/laetificat/slogger/pkg/slogger"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -17,7 +25,11 @@ var (
 		Short: "Show a list of watchers or domains",
 		Long: `Shows a list of items based on the given argument, available lists are
 - domains
-- watchers`,
+- watchers
+- failed, the jobs in the dead-letter queues of the running webserver`,
+		// The domains and the failed jobs can be listed while the webserver has the database open, the watchers are
+		// listed through the API of the webserver then.
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
 
@@ -25,7 +37,18 @@ var (
 				case "domains":
 					listDomains(os.Stdout)
 				case "watchers":
-					if err := listWatchers(map[string]string{}, os.Stdout); err != nil {
+					values := watcherQueryValues(cmd.Flags())
+					query, err := watcher.ParseQuery(values)
+					if err != nil {
+						slogger.Fatal(err.Error())
+					}
+
+					openDatabaseOrAPI()
+					if err := listWatchers(query, values, os.Stdout); err != nil {
+						slogger.Fatal(err.Error())
+					}
+				case "failed":
+					if err := listFailed(viper.GetString("webserver.address"), os.Stdout); err != nil {
 						slogger.Fatal(err.Error())
 					}
 				default:
@@ -38,10 +61,61 @@ var (
 	}
 )
 
+// listQueryFlags are the flags of list watchers with the query parameter of GET /watchers that they set.
+var listQueryFlags = map[string]string{
+	"domain":         "domain",
+	"name":           "name",
+	"url":            "url",
+	"url-prefix":     "url_prefix",
+	"tag":            "tag",
+	"collection":     "collection",
+	"user":           "user",
+	"checked-before": "checked_before",
+	"checked-after":  "checked_after",
+	"min-price":      "min_price",
+	"max-price":      "max_price",
+	"currency":       "currency",
+	"sort":           "sort",
+	"limit":          "limit",
+	"cursor":         "cursor",
+}
+
 func registerListCmd() {
+	flags := listCmd.Flags()
+	flags.String("domain", "", "only list the watchers of this domain")
+	flags.String("name", "", "only list the watchers with this text in their name")
+	flags.String("url", "", "only list the watcher with this URL")
+	flags.String("url-prefix", "", "only list the watchers with a URL that starts with this")
+	flags.String("tag", "", "only list the watchers with this tag, or with all the tags of a comma separated list")
+	flags.String("collection", "", "only list the watchers in this collection")
+	flags.String("user", "", "only list the watchers this user is subscribed to")
+	flags.String("checked-before", "", "only list the watchers last checked before this date or RFC 3339 time")
+	flags.String("checked-after", "", "only list the watchers last checked after this date or RFC 3339 time")
+	flags.String("min-price", "", "only list the watchers with a last price of at least this amount")
+	flags.String("max-price", "", "only list the watchers with a last price of at most this amount")
+	flags.String("currency", "", "convert the prices to this currency, also for --min-price, --max-price and --sort price")
+	flags.String("sort", "", "sort by id, name, price, last_checked or price_change, a '-' in front sorts descending")
+	flags.String("limit", "", "list at most this amount of watchers")
+	flags.String("cursor", "", "list the watchers after the page of this cursor")
+
 	rootCmd.AddCommand(listCmd)
 }
 
+/*
+watcherQueryValues returns the query parameters for the list watchers flags that are set.
+*/
+func watcherQueryValues(flags *pflag.FlagSet) url.Values {
+	values := url.Values{}
+	for flag, param := range listQueryFlags {
+		if flags.Changed(flag) {
+			value, _ := flags.GetString(flag)
+			values.Set(param, value)
+		}
+	}
+
+	return values
+}
+
 func listDomains(writer io.Writer) {
 	if _, err := writer.Write([]byte(fmt.Sprintln("Supported domains:"))); err != nil {
 		fmt.Println(err)
@@ -54,17 +128,112 @@ func listDomains(writer io.Writer) {
 	}
 }
 
-func listWatchers(filters map[string]string, writer io.Writer) error {
-	watcherList, err := watcher.List(filters)
+/*
+listWatchers writes the watchers that match the query to the writer, the query params are used for the API of the
+webserver when it has the database open.
+*/
+func listWatchers(query watcher.Query, values url.Values, writer io.Writer) error {
+	var watcherList []model.Watcher
+	var next string
+	var err error
+
+	if webserverAPI != nil {
+		watcherList, next, err = webserverAPI.listWatchers(values)
+	} else {
+		watcherList, next, err = watcher.List(watcherStore, query)
+	}
 	if err != nil {
 		return err
 	}
 
+	if query.Currency != "" && webserverAPI == nil {
+		table, err := rates.Load(watcherStore)
+		if err != nil {
+			return err
+		}
+
+		for i := range watcherList {
+			if err := table.ConvertWatcher(&watcherList[i], query.Currency); err != nil {
+				return err
+			}
+		}
+	}
+
 	for _, v := range watcherList {
 		if _, err := writer.Write([]byte(fmt.Sprintf("%+v\n", v))); err != nil {
 			fmt.Println(err)
 		}
 	}
 
+	if next != "" {
+		slogger.Info(fmt.Sprintf("There are more watchers, list them with --cursor %s", next))
+	}
+
+	return nil
+}
+
+/*
+listFailed writes the jobs in the dead-letter queues of the webserver on the given address to the writer.
+*/
+func listFailed(address string, writer io.Writer) error {
+	queues := struct {
+		Queues []string `json:"queues"`
+	}{}
+	if err := getJSON(address+"/queues", &queues); err != nil {
+		return err
+	}
+
+	for _, name := range queues.Queues {
+		failed := struct {
+			Jobs []*model.Job `json:"jobs"`
+		}{}
+		if err := getJSON(address+"/queues/"+name+"/failed", &failed); err != nil {
+			return err
+		}
+
+		for _, job := range failed.Jobs {
+			line := fmt.Sprintf(
+				"- %s: watcher %d (%s) failed %d times, last failure on %s: %s\n",
+				name,
+				job.ID,
+				job.URL,
+				job.Attempts,
+				job.FailedAt.Format(time.RFC3339),
+				job.LastError,
+			)
+
+			if _, err := writer.Write([]byte(line)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+
 	return nil
 }
+
+/*
+getJSON requests the given URL of the webserver with the token of the workers and decodes the JSON response into
+the target.
+*/
+func getJSON(url string, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	if token := workerToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting '%s' failed, status code %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(target)
+}
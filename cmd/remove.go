@@ -12,8 +12,9 @@ var removeAll bool
 
 var (
 	removeCmd = &cobra.Command{
-		Use:   "remove",
-		Short: "Remove a price watcher",
+		Use:         "remove",
+		Short:       "Remove a price watcher",
+		Annotations: map[string]string{annotationUseAPI: "true"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
 				if err := removeWatcher(args[0]); err != nil {
@@ -21,7 +22,7 @@ var (
 				}
 			} else {
 				if removeAll {
-					if err := watcher.RemoveAll(); err != nil {
+					if err := removeAllWatchers(); err != nil {
 						log.Panic(err)
 					}
 				} else {
@@ -44,5 +45,17 @@ func removeWatcher(id string) error {
 		return err
 	}
 
-	return watcher.Remove(idInt)
+	if webserverAPI != nil {
+		return webserverAPI.removeWatcher(idInt)
+	}
+
+	return watcher.Remove(watcherStore, idInt)
+}
+
+func removeAllWatchers() error {
+	if webserverAPI != nil {
+		return webserverAPI.removeAll()
+	}
+
+	return watcher.RemoveAll(watcherStore)
 }
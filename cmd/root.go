@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/laetificat/pricewatcher/internal/extractor"
+	"github.com/laetificat/pricewatcher/internal/migration"
+	"github.com/laetificat/pricewatcher/internal/store"
 	"github.com/laetificat/slogger/pkg/slogger"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -16,9 +19,35 @@ var (
 		Use:   "pricewatcher",
 		Short: "A tool to manage your price watchers",
 		Long:  `Pricewatcher is a CLI tool that manages your price watcher API for your horde of watchers.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			switch {
+			case cmd.Annotations[annotationUseAPI] != "":
+				openDatabaseOrAPI()
+			case cmd.Annotations[annotationSkipDatabase] == "":
+				openDatabase()
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if watcherStore != nil {
+				if err := watcherStore.Close(); err != nil {
+					slogger.Error(err.Error())
+				}
+			}
+		},
 	}
+
+	// watcherStore is the watcher database, it is opened once before a command runs.
+	watcherStore store.Store
 )
 
+// annotationSkipDatabase marks the commands that do not use the watcher database, or that open it themselves, so the
+// database is not migrated and opened before they run.
+const annotationSkipDatabase = "skip_database"
+
+// annotationUseAPI marks the watcher commands that use the API of the webserver when the webserver has the bolt
+// database open.
+const annotationUseAPI = "use_api"
+
 // Execute executes the root command.
 func Execute() error {
 	registerRootCmd()
@@ -27,6 +56,11 @@ func Execute() error {
 	registerRemoveCmd()
 	registerListCmd()
 	registerAddCmd()
+	registerGetCmd()
+	registerEditCmd()
+	registerWorkerCmd()
+	registerDbCmd()
+	registerUserCmd()
 	return rootCmd.Execute()
 }
 
@@ -64,6 +98,14 @@ func registerRootCmd() {
 		slogger.Fatal(err.Error())
 	}
 	viper.SetDefault("database_file", "watchers.db")
+	viper.SetDefault("database.driver", store.DriverBolt)
+	viper.SetDefault("database.timeout", "5s")
+
+	viper.SetDefault("notification.email.template", "templates/notification.htm")
+	viper.SetDefault("notification.email.smtp.host", "localhost")
+	viper.SetDefault("notification.email.smtp.port", 25)
+	viper.SetDefault("notification.webhook.timeout", "10s")
+	viper.SetDefault("notification.slack.timeout", "10s")
 }
 
 /*
@@ -102,4 +144,72 @@ func initConfig() {
 	slogger.SetConfig(c)
 
 	slogger.Debug(fmt.Sprintf("Using config file: %s", viper.ConfigFileUsed()))
+
+	if err := extractor.LoadRules(); err != nil {
+		slogger.Fatal(err.Error())
+	}
+}
+
+/*
+migrateDatabase applies the pending migrations to the bolt database at the given path.
+*/
+func migrateDatabase(path string) error {
+	result, err := migration.Migrate(path, viper.GetDuration("database.timeout"), false)
+	if err != nil {
+		return err
+	}
+
+	if result.Backup != "" {
+		slogger.Info(fmt.Sprintf("Backed up the database to '%s' before migrating", result.Backup))
+	}
+
+	for _, m := range result.Applied {
+		slogger.Info(fmt.Sprintf("Applied migration %d: %s", m.Version, m.Description))
+	}
+
+	return nil
+}
+
+/*
+openDatabase opens the configured watcher database for the command.
+*/
+func openDatabase() {
+	s, err := openStore(viper.GetString("database.driver"), viper.GetString("database_file"))
+	if err != nil {
+		slogger.Fatal(err.Error())
+	}
+
+	watcherStore = s
+}
+
+/*
+openDatabaseOrAPI opens the configured watcher database for the command, when the webserver has the bolt database open
+the command uses the API of the webserver on webserver.address instead and watcherStore stays nil.
+*/
+func openDatabaseOrAPI() {
+	s, err := openStore(viper.GetString("database.driver"), viper.GetString("database_file"))
+	if err == store.ErrInUse {
+		slogger.Debug(fmt.Sprintf("The database is in use, using the API of the webserver on %s", viper.GetString("webserver.address")))
+		webserverAPI = newAPIClient(viper.GetString("webserver.address"), viper.GetString("admin.token"))
+		return
+	}
+	if err != nil {
+		slogger.Fatal(err.Error())
+	}
+
+	watcherStore = s
+}
+
+/*
+openStore opens the store of the driver at the given path, a bolt database is migrated first. Only one process can have
+a bolt database open at a time.
+*/
+func openStore(driver, path string) (store.Store, error) {
+	if driver == store.DriverBolt {
+		if err := migrateDatabase(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return store.Open(driver, path, viper.GetDuration("database.timeout"))
 }
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/account"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	userAdmin bool
+	userCmd   = &cobra.Command{
+		Use:   "user",
+		Short: "Manage the user accounts of the webserver",
+		Long: `Manage the user accounts of the webserver. As long as there are no users the webserver can be used without a
+token, once there are users every request needs the token of a user as bearer token. A bolt database can not be
+opened while the webserver runs, use the /v2/users routes of the running webserver instead.`,
+	}
+	userAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add a user and print its token",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := addUser(args[0], userAdmin); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	userListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the users",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listUsers(os.Stdout); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	userRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a user and unsubscribe it from its watchers",
+		Long: `Remove a user and unsubscribe it from its watchers, the watchers that no other user is subscribed to are removed
+with their price history.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := removeUser(args[0]); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+	userTokenCmd = &cobra.Command{
+		Use:   "token <name>",
+		Short: "Give a user a new token and print it, the old token stops working",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := resetUserToken(args[0]); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+)
+
+func registerUserCmd() {
+	userAddCmd.PersistentFlags().BoolVar(&userAdmin, "admin", false, "make the user an admin that sees and changes all the watchers")
+
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userRemoveCmd)
+	userCmd.AddCommand(userTokenCmd)
+	rootCmd.AddCommand(userCmd)
+}
+
+/*
+addUser creates the user and prints its token, the token can not be shown again.
+*/
+func addUser(name string, admin bool) error {
+	user, token, err := account.Create(watcherStore, name, admin)
+	if err != nil {
+		return err
+	}
+
+	slogger.Info(fmt.Sprintf("Added user '%s', the token is only shown once", user.Name))
+	fmt.Println(token)
+
+	return nil
+}
+
+/*
+listUsers writes the users with their role and creation time to the writer.
+*/
+func listUsers(writer io.Writer) error {
+	users, err := account.List(watcherStore)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		role := "user"
+		if user.Admin {
+			role = "admin"
+		}
+
+		line := fmt.Sprintf("- %s: %s, created on %s\n", user.Name, role, user.Created.Format(time.RFC3339))
+		if _, err := writer.Write([]byte(line)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
+
+/*
+removeUser removes the user and unsubscribes it from its watchers.
+*/
+func removeUser(name string) error {
+	unsubscribed, err := account.Remove(watcherStore, name)
+	if err != nil {
+		return userError(name, err)
+	}
+
+	slogger.Info(fmt.Sprintf("Removed user '%s' and unsubscribed it from %d watcher(s)", name, unsubscribed))
+	return nil
+}
+
+/*
+resetUserToken gives the user a new token and prints it.
+*/
+func resetUserToken(name string) error {
+	token, err := account.ResetToken(watcherStore, name)
+	if err != nil {
+		return userError(name, err)
+	}
+
+	slogger.Info(fmt.Sprintf("Gave user '%s' a new token, the token is only shown once", name))
+	fmt.Println(token)
+
+	return nil
+}
+
+/*
+userError returns the error for the user with the given name, with the name in the message when the user is not found.
+*/
+func userError(name string, err error) error {
+	if err == account.ErrNotFound {
+		return fmt.Errorf("no user found with name '%s'", name)
+	}
+
+	return err
+}
@@ -1,25 +1,41 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 
-	"github.com/laetificat/pricewatcher/internal/watcher"
 	"github.com/laetificat/slogger/pkg/slogger"
 	"github.com/spf13/cobra"
 )
 
 var (
-	watchCmd = &cobra.Command{
+	watchTags       []string
+	watchCollection string
+	watchCmd        = &cobra.Command{
 		Use:   "watch",
 		Short: "Run all the watchers",
+		Long: `Periodically asks the running webserver to add the watchers that need to be checked to the queues, the
+webserver has the database open. With --tag or --collection only those watchers are run.`,
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
 		Run: func(cmd *cobra.Command, args []string) {
-			checkWatchers()
+			query := url.Values{}
+			if len(watchTags) > 0 {
+				query.Set("tag", strings.Join(watchTags, ","))
+			}
+			if watchCollection != "" {
+				query.Set("collection", watchCollection)
+			}
+
+			checkWatchers(query)
 			ticker := time.NewTicker(viper.GetDuration("watcher.timeout") * time.Minute)
 			for range ticker.C {
-				checkWatchers()
+				checkWatchers(query)
 			}
 		},
 	}
@@ -37,13 +53,39 @@ func registerWatchCmd() {
 		slogger.Fatal(err.Error())
 	}
 
+	watchCmd.PersistentFlags().StringSliceVar(
+		&watchTags,
+		"tag",
+		nil,
+		"only run the watchers with this tag, or with all the tags of a comma separated list",
+	)
+	watchCmd.PersistentFlags().StringVar(&watchCollection, "collection", "", "only run the watchers in this collection")
+
 	rootCmd.AddCommand(watchCmd)
 }
 
-func checkWatchers() {
+/*
+checkWatchers asks the webserver to run the watchers that match the query, with the admin.token from the config so
+the watchers of all the users are run.
+*/
+func checkWatchers(query url.Values) {
 	slogger.Debug("Checking if queues need to be filled...")
-	err := watcher.RunAll()
+	req, err := http.NewRequest(http.MethodGet, viper.GetString("webserver.address")+"/watchers/run?"+query.Encode(), nil)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	if token := viper.GetString("admin.token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Panic(fmt.Errorf("running the watchers failed, status code %d", res.StatusCode))
+	}
 }
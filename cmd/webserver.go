@@ -1,15 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/helper"
 	"github.com/laetificat/pricewatcher/internal/queue"
-	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/pricewatcher/internal/rates"
 	"github.com/laetificat/pricewatcher/internal/web/api"
 	"github.com/laetificat/pricewatcher/internal/web/middleware"
+	"github.com/laetificat/pricewatcher/internal/worker"
 	"github.com/laetificat/slogger/pkg/slogger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -20,7 +24,21 @@ var (
 		Use:   "webserver",
 		Short: "Start the webserver",
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := queue.Open(viper.GetString("queue.database_file")); err != nil {
+				slogger.Fatal(err.Error())
+			}
+			defer queue.Close()
+
 			registerQueues()
+
+			if viper.GetString("rates.source") != "" {
+				go refreshRates(viper.GetDuration("rates.refresh_interval"))
+			}
+
+			if workers := viper.GetInt("worker.in_process"); workers > 0 {
+				runLocalWorkers(workers)
+			}
+
 			runWebserver()
 		},
 	}
@@ -39,16 +57,45 @@ func registerWebserverCmd() {
 	}
 	viper.SetDefault("webserver.address", "http://localhost:8080")
 
+	webserverCmd.PersistentFlags().String(
+		"queue-database",
+		"queue.db",
+		"the path to the queue database file",
+	)
+
+	if err := viper.BindPFlag("queue.database_file", webserverCmd.PersistentFlags().Lookup("queue-database")); err != nil {
+		slogger.Fatal(err.Error())
+	}
+	viper.SetDefault("queue.database_file", "queue.db")
+	viper.SetDefault("queue.lease_timeout", "5m")
+	viper.SetDefault("queue.max_attempts", 3)
+	viper.SetDefault("queue.max_wait", "60s")
+
+	viper.SetDefault("admin.token", "")
+
+	viper.SetDefault("rates.base", "EUR")
+	viper.SetDefault("rates.timeout", "30s")
+	viper.SetDefault("rates.refresh_interval", "24h")
+
+	webserverCmd.PersistentFlags().Int(
+		"workers",
+		0,
+		"the amount of workers to run in the webserver for every queue",
+	)
+
+	if err := viper.BindPFlag("worker.in_process", webserverCmd.PersistentFlags().Lookup("workers")); err != nil {
+		slogger.Fatal(err.Error())
+	}
+
 	rootCmd.AddCommand(webserverCmd)
 }
 
 /*
-registerQueues registers queues based on the supported domains that are supported
+registerQueues registers queues based on the supported domains that are supported and the generic queue for the other
+domains
 */
 func registerQueues() {
-	for _, v := range watcher.SupportedDomains {
-		queueName := queue.GetNameForDomain(v)
-
+	for _, queueName := range helper.GetQueueNames() {
 		slogger.Debug(
 			fmt.Sprintf("creating queue '%s'", queueName),
 		)
@@ -59,6 +106,38 @@ func registerQueues() {
 	}
 }
 
+/*
+refreshRates fetches the exchange rates now and then every interval, failures are logged and retried at the next
+interval.
+*/
+func refreshRates(interval time.Duration) {
+	for {
+		days, err := rates.Update(watcherStore)
+		if err != nil {
+			slogger.Error(fmt.Sprintf("could not update the exchange rates: %s", err.Error()))
+		} else {
+			slogger.Debug(fmt.Sprintf("Stored the exchange rates of %d day(s)", days))
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+/*
+runLocalWorkers starts the given amount of workers for every queue that take their jobs directly from the queues.
+*/
+func runLocalWorkers(amount int) {
+	slogger.Info(fmt.Sprintf("Starting %d worker(s) per queue...", amount))
+
+	for i := 0; i < amount; i++ {
+		go func() {
+			if err := newWorker(&worker.LocalSource{Store: watcherStore}).Run(context.Background(), nil); err != nil {
+				slogger.Error(err.Error())
+			}
+		}()
+	}
+}
+
 /*
 runWebserver registers the routes, adds middlewares and starts listening on the given address and port
 */
@@ -69,9 +148,14 @@ func runWebserver() {
 
 	slogger.Debug("Registering routes...")
 	api.RegisterHomeHandler(router)
-	api.RegisterWatcherHandler(router)
-	api.RegisterPriceHandler(router)
-	api.RegisterQueueHandler(router)
+	api.RegisterWatcherHandler(router, watcherStore)
+	api.RegisterWatcherHandlerV2(router, watcherStore)
+	api.RegisterCollectionHandler(router, watcherStore)
+	api.RegisterUserHandler(router, watcherStore)
+	api.RegisterPriceHandler(router, watcherStore)
+	api.RegisterQueueHandler(router, watcherStore)
+	api.RegisterEventHandler(router, watcherStore)
+	api.RegisterAdminHandler(router, watcherStore)
 
 	routerWithMiddleWare := middleware.NewLogMiddleWare(router)
 
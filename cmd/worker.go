@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/laetificat/pricewatcher/internal/worker"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	workerQueues []string
+	workerCmd    = &cobra.Command{
+		Use:   "worker",
+		Short: "Run a worker that checks the prices of the queued jobs",
+		Long: `Run a worker that takes the jobs from the queues of the running webserver, fetches the product pages and
+reports the prices back to the webserver.`,
+		Annotations: map[string]string{annotationSkipDatabase: "true"},
+		Run: func(cmd *cobra.Command, args []string) {
+			// Bound here because the webserver binds its own address flag to the same key.
+			if err := viper.BindPFlag("webserver.address", cmd.PersistentFlags().Lookup("address")); err != nil {
+				slogger.Fatal(err.Error())
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, os.Interrupt)
+				<-signals
+				slogger.Info("Stopping worker...")
+				cancel()
+			}()
+
+			source := worker.NewHTTPSource(viper.GetString("webserver.address"))
+			source.Token = workerToken()
+
+			w := newWorker(source)
+			if err := w.Run(ctx, workerQueues); err != nil {
+				slogger.Fatal(err.Error())
+			}
+		},
+	}
+)
+
+func registerWorkerCmd() {
+	workerCmd.PersistentFlags().StringSliceVarP(
+		&workerQueues,
+		"queues",
+		"q",
+		[]string{},
+		"the queues to take jobs from, all the queues are used if none are given",
+	)
+
+	workerCmd.PersistentFlags().StringP(
+		"address",
+		"a",
+		"http://localhost:8080",
+		"the address of the webserver to take the jobs from",
+	)
+
+	viper.SetDefault("worker.user_agent", "Mozilla/5.0 (compatible; pricewatcher)")
+	viper.SetDefault("worker.timeout", "30s")
+	viper.SetDefault("worker.wait", "30s")
+	viper.SetDefault("worker.allow_private_addresses", false)
+	viper.SetDefault("worker.max_body_size", worker.DefaultMaxBodySize)
+	viper.SetDefault("worker.token", "")
+
+	rootCmd.AddCommand(workerCmd)
+}
+
+/*
+newWorker returns a worker for the given source configured with the [worker] config section.
+*/
+func newWorker(source worker.Source) *worker.Worker {
+	w := worker.New(
+		source,
+		viper.GetString("worker.user_agent"),
+		viper.GetDuration("worker.timeout"),
+		viper.GetDuration("worker.wait"),
+	)
+	w.AllowPrivate = viper.GetBool("worker.allow_private_addresses")
+	w.MaxBodySize = viper.GetInt64("worker.max_body_size")
+
+	return w
+}
+
+/*
+workerToken returns the bearer token for the queue and price routes of the webserver, the worker.token from the config
+or the admin.token when no worker token is configured.
+*/
+func workerToken() string {
+	if token := viper.GetString("worker.token"); token != "" {
+		return token
+	}
+
+	return viper.GetString("admin.token")
+}
@@ -0,0 +1,185 @@
+package account
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+)
+
+// namePattern are the valid user names, lowercase letters, digits, dots, dashes and underscores.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+var (
+	// ErrNotFound is returned when no user exists with the given name.
+	ErrNotFound = fmt.Errorf("user not found")
+	// ErrExists is returned when a user is created with the name of an existing user.
+	ErrExists = fmt.Errorf("a user with this name already exists")
+	// ErrUnauthorized is returned when a token does not belong to any user.
+	ErrUnauthorized = fmt.Errorf("the token does not belong to any user")
+)
+
+/*
+Create creates a user with the given name and returns it with its token, the token is only stored as a hash so it can
+not be shown again.
+*/
+func Create(s store.Store, name string, admin bool) (*model.User, string, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, "", err
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	_, err := s.User(name)
+	if err == nil {
+		return nil, "", ErrExists
+	}
+	if err != store.ErrNotFound {
+		return nil, "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	user := &model.User{Name: name, TokenHash: hashToken(token), Admin: admin, Created: time.Now()}
+	if err := s.SaveUser(user); err != nil {
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+/*
+ValidateName checks if the name can be used for a user, names are stored in lowercase.
+*/
+func ValidateName(name string) error {
+	if !namePattern.MatchString(strings.ToLower(strings.TrimSpace(name))) {
+		return fmt.Errorf(
+			"user name '%s' can only have letters, digits, dots, dashes and underscores and up to 50 characters",
+			name,
+		)
+	}
+
+	return nil
+}
+
+/*
+Get returns the user with the given name.
+*/
+func Get(s store.Store, name string) (*model.User, error) {
+	user, err := s.User(strings.ToLower(name))
+	if err == store.ErrNotFound {
+		return nil, ErrNotFound
+	}
+
+	return user, err
+}
+
+/*
+List returns all the users ordered by name.
+*/
+func List(s store.Store) ([]model.User, error) {
+	return s.Users()
+}
+
+/*
+Enabled checks if there are any users, without users the webserver is used without authentication like before there
+were accounts.
+*/
+func Enabled(s store.Store) (bool, error) {
+	users, err := s.Users()
+	if err != nil {
+		return false, err
+	}
+
+	return len(users) > 0, nil
+}
+
+/*
+Authenticate returns the user the token belongs to, or ErrUnauthorized.
+*/
+func Authenticate(s store.Store, token string) (*model.User, error) {
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+
+	users, err := s.Users()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := []byte(hashToken(token))
+	for i := range users {
+		if subtle.ConstantTimeCompare(hash, []byte(users[i].TokenHash)) == 1 {
+			return &users[i], nil
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+/*
+ResetToken gives the user with the given name a new token and returns it, the old token stops working.
+*/
+func ResetToken(s store.Store, name string) (string, error) {
+	user, err := Get(s, name)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	user.TokenHash = hashToken(token)
+
+	return token, s.SaveUser(user)
+}
+
+/*
+Remove removes the user with the given name and unsubscribes it from its watchers, the watchers without other
+subscribers are removed with their price history. Returns the amount of watchers the user was subscribed to.
+*/
+func Remove(s store.Store, name string) (int, error) {
+	user, err := Get(s, name)
+	if err != nil {
+		return 0, err
+	}
+
+	unsubscribed, err := watcher.UnsubscribeAll(s, user.Name)
+	if err != nil {
+		return unsubscribed, err
+	}
+
+	return unsubscribed, s.RemoveUser(user.Name)
+}
+
+/*
+newToken returns a new random token.
+*/
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+/*
+hashToken returns the SHA-256 hash of the token as hex, tokens are random so they do not need a salt.
+*/
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,4 @@
+/*
+Package account contains the user accounts of the webserver and the authentication of their tokens.
+*/
+package account
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// WatcherCreated is published when a watcher is added, the data is the watcher.
+	WatcherCreated = "watcher_created"
+	// WatcherUpdated is published when a watcher is edited, the data is the changed watcher.
+	WatcherUpdated = "watcher_updated"
+	// WatcherRemoved is published when a watcher is removed.
+	WatcherRemoved = "watcher_removed"
+	// PriceUpdated is published when a new price is recorded for a watcher, the data is the update.
+	PriceUpdated = "price_updated"
+	// AlertTriggered is published when an alert rule of a watcher triggered.
+	AlertTriggered = "alert_triggered"
+	// JobQueued is published when a job is added to a queue.
+	JobQueued = "job_queued"
+	// JobLeased is published when a job is handed out to a worker.
+	JobLeased = "job_leased"
+)
+
+// Event is a single event with an incrementing ID. Subscribers are the users subscribed to the watcher of the event
+// when it was published, only they and the admins should receive it.
+type Event struct {
+	ID          uint64
+	Type        string
+	Subscribers []string
+	Data        interface{}
+	Timestamp   time.Time
+}
+
+// Subscription receives the published events that match its types.
+type Subscription struct {
+	broker *Broker
+	types  map[string]bool
+	events chan Event
+}
+
+// Broker publishes events to its subscriptions and keeps a history so clients can catch up after reconnecting.
+type Broker struct {
+	mu            sync.Mutex
+	lastID        uint64
+	history       []Event
+	historySize   int
+	subscriptions map[*Subscription]struct{}
+}
+
+var defaultBroker = NewBroker(1000)
+
+/*
+NewBroker returns a broker that keeps the given amount of events in its history.
+*/
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		historySize:   historySize,
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+/*
+Publish publishes an event with the given type, subscribers and data on the default broker.
+*/
+func Publish(eventType string, subscribers []string, data interface{}) {
+	defaultBroker.Publish(eventType, subscribers, data)
+}
+
+/*
+Subscribe subscribes to the default broker, see Broker.Subscribe.
+*/
+func Subscribe(types []string, lastID uint64) (*Subscription, []Event) {
+	return defaultBroker.Subscribe(types, lastID)
+}
+
+/*
+Publish publishes an event with the given type, subscribers and data to all the subscriptions, the subscribers are
+copied so later changes to the watcher do not change the event.
+A subscription that does not keep up is closed, the client can reconnect and catch up from the history.
+*/
+func (b *Broker) Publish(eventType string, subscribers []string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{
+		ID:          b.lastID,
+		Type:        eventType,
+		Subscribers: append([]string(nil), subscribers...),
+		Data:        data,
+		Timestamp:   time.Now(),
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for s := range b.subscriptions {
+		if !s.matches(eventType) {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			b.remove(s)
+		}
+	}
+}
+
+/*
+Subscribe returns a subscription for the given event types, all types are subscribed to when none are given.
+The events from the history after lastID are returned so a reconnecting client does not miss events, when lastID is
+from before a restart of the broker the whole history is returned.
+*/
+func (b *Broker) Subscribe(types []string, lastID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{broker: b, types: map[string]bool{}, events: make(chan Event, 64)}
+	for _, t := range types {
+		s.types[t] = true
+	}
+
+	var missed []Event
+	if lastID > 0 {
+		if lastID > b.lastID {
+			lastID = 0
+		}
+
+		for _, event := range b.history {
+			if event.ID > lastID && s.matches(event.Type) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	b.subscriptions[s] = struct{}{}
+
+	return s, missed
+}
+
+/*
+Events returns the channel with the events of the subscription, the channel is closed when the subscription is closed.
+*/
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+/*
+Close stops the subscription.
+*/
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+/*
+HasSubscriber checks if the user with the given name was subscribed to the watcher of the event.
+*/
+func (e Event) HasSubscriber(user string) bool {
+	for _, subscriber := range e.Subscribers {
+		if subscriber == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+matches checks if the subscription is subscribed to the event type.
+*/
+func (s *Subscription) matches(eventType string) bool {
+	return len(s.types) == 0 || s.types[eventType]
+}
+
+/*
+remove removes the subscription and closes its channel, the caller must hold the lock.
+*/
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subscriptions[s]; !ok {
+		return
+	}
+
+	delete(b.subscriptions, s)
+	close(s.events)
+}
@@ -0,0 +1,4 @@
+/*
+Package events contains the in-process event broker that is used to stream activity to clients.
+*/
+package events
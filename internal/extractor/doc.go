@@ -0,0 +1,4 @@
+/*
+Package extractor contains all the code that extracts product information from product pages.
+*/
+package extractor
@@ -0,0 +1,271 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+)
+
+// Product is the product information that is extracted from a product page.
+type Product struct {
+	Name         string
+	Price        money.Money
+	Availability string
+	GTIN         string
+}
+
+// Extractor extracts the product information from a parsed product page.
+type Extractor interface {
+	Extract(doc *goquery.Document) (*Product, error)
+}
+
+// defaultRules are the rules for the domains that are supported without configuration.
+var defaultRules = []Rule{
+	{
+		Domain:   "bol.com",
+		Name:     []string{`[data-test="title"]`, "h1"},
+		Price:    []string{`meta[itemprop="price"]@content`, `[data-test="price"]@content`, "jsonld:offers.price"},
+		Currency: []string{`meta[itemprop="priceCurrency"]@content`, "jsonld:offers.priceCurrency"},
+	},
+	{
+		Domain:   "ebay.nl",
+		Name:     []string{"h1.x-item-title__mainTitle span", "#itemTitle", "h1"},
+		Price:    []string{`[itemprop="price"]@content`, "#prcIsum@content", ".x-price-primary"},
+		Currency: []string{`[itemprop="priceCurrency"]@content`},
+	},
+	{
+		Domain:   "coolblue.nl",
+		Name:     []string{"h1.js-product-name", "h1"},
+		Price:    []string{`meta[property="product:price:amount"]@content`, `meta[itemprop="price"]@content`, ".sales-price__current"},
+		Currency: []string{`meta[property="product:price:currency"]@content`, `meta[itemprop="priceCurrency"]@content`},
+	},
+}
+
+// rules contains the loaded domain rules in the order they were loaded, the default rules are loaded on first use when
+// LoadRules was not called.
+var rules = struct {
+	sync.RWMutex
+	defaults sync.Once
+	list     []*Rule
+}{}
+
+/*
+LoadRules loads the domain rules from the "domains" config key and the files in the "domains_dir" directory on top of
+the default rules, a rule replaces an earlier rule for the same domain.
+*/
+func LoadRules() error {
+	var configured []Rule
+	if err := viper.UnmarshalKey("domains", &configured); err != nil {
+		return fmt.Errorf("could not read the domain rules: %s", err.Error())
+	}
+
+	if dir := viper.GetString("domains_dir"); dir != "" {
+		fromDir, err := readRulesDir(dir)
+		if err != nil {
+			return err
+		}
+
+		configured = append(configured, fromDir...)
+	}
+
+	return setRules(configured)
+}
+
+/*
+readRulesDir reads the domain rules from every config file in the directory, the files use the same "domains" list as
+the config file. Files are read in alphabetical order.
+*/
+func readRulesDir(dir string) ([]Rule, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the domain rules directory: %s", err.Error())
+	}
+
+	var loaded []Rule
+	for _, file := range files {
+		extension := strings.TrimPrefix(filepath.Ext(file.Name()), ".")
+		if file.IsDir() || !stringInSlice(extension, viper.SupportedExts) {
+			continue
+		}
+
+		v := viper.New()
+		v.SetConfigFile(filepath.Join(dir, file.Name()))
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("could not read domain rules from '%s': %s", file.Name(), err.Error())
+		}
+
+		var fileRules []Rule
+		if err := v.UnmarshalKey("domains", &fileRules); err != nil {
+			return nil, fmt.Errorf("could not read domain rules from '%s': %s", file.Name(), err.Error())
+		}
+
+		loaded = append(loaded, fileRules...)
+	}
+
+	return loaded, nil
+}
+
+/*
+setRules compiles the default rules and the given rules and replaces the loaded rules with them.
+*/
+func setRules(configured []Rule) error {
+	var list []*Rule
+	index := map[string]int{}
+
+	for _, rule := range append(append([]Rule{}, defaultRules...), configured...) {
+		rule := rule
+		rule.Domain = strings.ToLower(rule.Domain)
+
+		if err := rule.compile(); err != nil {
+			return err
+		}
+
+		if i, ok := index[rule.Domain]; ok {
+			list[i] = &rule
+			continue
+		}
+
+		index[rule.Domain] = len(list)
+		list = append(list, &rule)
+	}
+
+	rules.Lock()
+	rules.list = list
+	rules.Unlock()
+
+	return nil
+}
+
+/*
+loadedRules returns the loaded rules, the default rules are loaded when no rules were loaded yet. The list is replaced
+and never changed, so it can be used without the lock.
+*/
+func loadedRules() []*Rule {
+	rules.defaults.Do(func() {
+		rules.RLock()
+		loaded := rules.list != nil
+		rules.RUnlock()
+
+		if !loaded {
+			if err := setRules(nil); err != nil {
+				slogger.Error(fmt.Sprintf("could not load the default domain rules: %s", err.Error()))
+			}
+		}
+	})
+
+	rules.RLock()
+	defer rules.RUnlock()
+
+	return rules.list
+}
+
+/*
+Domains returns the domains of the loaded rules.
+*/
+func Domains() []string {
+	list := loadedRules()
+
+	domains := make([]string, 0, len(list))
+	for _, rule := range list {
+		domains = append(domains, rule.Domain)
+	}
+
+	return domains
+}
+
+/*
+ForDomain returns the extractor for the given domain, domains without a rule use the structured data of the page.
+*/
+func ForDomain(domain string) Extractor {
+	for _, rule := range loadedRules() {
+		if rule.Domain == strings.ToLower(domain) {
+			return rule
+		}
+	}
+
+	return structuredData
+}
+
+/*
+DomainForURL returns the domain of the first rule that matches the given URL.
+*/
+func DomainForURL(pageURL string) (string, bool) {
+	for _, rule := range loadedRules() {
+		if rule.Matches(pageURL) {
+			return rule.Domain, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+Extract parses the HTML page from the reader and extracts the product information with the extractor for the given
+domain.
+*/
+func Extract(domain string, page io.Reader) (*Product, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return ForDomain(domain).Extract(doc)
+}
+
+/*
+ParsePrice parses a price in the given currency as it is shown on a web page, for example "€ 1.299,99", "1,299.99",
+"19,-" or "19.99". The last "." or "," is used as decimal separator when it is followed by one or two digits.
+*/
+func ParsePrice(s, currency string) (money.Money, error) {
+	var cleaned strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) || r == '.' || r == ',' {
+			cleaned.WriteRune(r)
+		}
+	}
+
+	value := strings.Trim(cleaned.String(), ".,")
+	if value == "" {
+		return money.Money{}, fmt.Errorf("no price found in '%s'", s)
+	}
+
+	decimals := ""
+	if i := strings.LastIndexAny(value, ".,"); i >= 0 && len(value)-i-1 <= 2 {
+		decimals = value[i+1:]
+		value = value[:i]
+	}
+
+	value = strings.NewReplacer(".", "", ",", "").Replace(value)
+	if decimals != "" {
+		value += "." + decimals
+	}
+
+	price, err := money.Parse(value, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("could not parse price '%s': %s", s, err.Error())
+	}
+
+	return price, nil
+}
+
+/*
+stringInSlice checks if the slice contains the string.
+*/
+func stringInSlice(s string, slice []string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,43 @@
+package extractor
+
+import (
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		currency string
+		want     string
+		wantErr  bool
+	}{
+		{name: "decimal point", value: "19.99", currency: "EUR", want: "19.99 EUR"},
+		{name: "decimal comma", value: "19,99", currency: "EUR", want: "19.99 EUR"},
+		{name: "thousands points and decimal comma", value: "€ 1.299,99", currency: "EUR", want: "1299.99 EUR"},
+		{name: "thousands commas and decimal point", value: "$1,299.99", currency: "USD", want: "1299.99 USD"},
+		{name: "whole amount with a dash", value: "19,-", currency: "EUR", want: "19.00 EUR"},
+		{name: "thousands point without decimals", value: "1.299", currency: "EUR", want: "1299.00 EUR"},
+		{name: "single decimal", value: "4,5", currency: "EUR", want: "4.50 EUR"},
+		{name: "no digits", value: "sold out", currency: "EUR", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePrice(tt.value, tt.currency)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.String() != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
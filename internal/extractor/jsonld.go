@@ -0,0 +1,120 @@
+package extractor
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+/*
+jsonLDProducts returns the schema.org Product objects in the JSON-LD scripts of the document, scripts that are not
+valid JSON are skipped.
+*/
+func jsonLDProducts(doc *goquery.Document) []map[string]interface{} {
+	var products []map[string]interface{}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, script *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(script.Text()), &data); err != nil {
+			return
+		}
+
+		products = append(products, findTyped(data, "Product")...)
+	})
+
+	return products
+}
+
+/*
+findTyped returns the objects with the given schema.org type in the JSON-LD data, including the objects in lists and
+in "@graph".
+*/
+func findTyped(data interface{}, schemaType string) []map[string]interface{} {
+	var found []map[string]interface{}
+
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			found = append(found, findTyped(item, schemaType)...)
+		}
+	case map[string]interface{}:
+		if hasType(v, schemaType) {
+			found = append(found, v)
+		}
+
+		if graph, ok := v["@graph"]; ok {
+			found = append(found, findTyped(graph, schemaType)...)
+		}
+	}
+
+	return found
+}
+
+/*
+hasType checks if the "@type" of the object is, or contains, the given type. Types can be written as a full
+schema.org URL.
+*/
+func hasType(object map[string]interface{}, schemaType string) bool {
+	var types []interface{}
+
+	switch t := object["@type"].(type) {
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+
+	for _, t := range types {
+		if s, ok := t.(string); ok && (s == schemaType || strings.HasSuffix(s, "/"+schemaType)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+lookup returns the value at the path in the JSON-LD data as text, the first item is used when the path runs into a
+list.
+*/
+func lookup(data interface{}, path []string) string {
+	for {
+		list, ok := data.([]interface{})
+		if !ok {
+			break
+		}
+
+		if len(list) == 0 {
+			return ""
+		}
+
+		data = list[0]
+	}
+
+	if len(path) == 0 {
+		switch v := data.(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case map[string]interface{}:
+			// Values can be written as objects, for example {"@type": "Brand", "name": "..."} or {"@value": "..."}.
+			if value, ok := v["@value"]; ok {
+				return lookup(value, nil)
+			}
+
+			return lookup(v["name"], nil)
+		default:
+			return ""
+		}
+	}
+
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	return lookup(object[path[0]], path[1:])
+}
@@ -0,0 +1,241 @@
+package extractor
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/laetificat/pricewatcher/internal/money"
+)
+
+// The prefixes of the field rules, a field rule without prefix is a CSS selector.
+const (
+	prefixCSS    = "css:"
+	prefixRegex  = "regex:"
+	prefixJSONLD = "jsonld:"
+)
+
+// Rule describes a supported domain, which URLs belong to it and how the product information is extracted from its
+// pages. Every field has a list of field rules that are tried in order until one of them finds a value:
+//   - "css:<selector>" uses the text of the first element matching the CSS selector, or the value of an attribute when
+//     the selector ends with "@attribute". The "css:" prefix is optional.
+//   - "regex:<pattern>" uses the first group of the regular expression, or the whole match without groups, on the HTML
+//     of the page.
+//   - "jsonld:<path>" uses the value at the dot separated path in the first schema.org Product in the JSON-LD of the
+//     page, for example "offers.price". The first item is used when the path runs into a list.
+//
+// Fields that none of the field rules find are taken from the structured data of the page.
+type Rule struct {
+	Domain       string
+	Match        []string
+	Name         []string
+	Price        []string
+	Currency     []string
+	Availability []string
+	GTIN         []string
+
+	patterns []*regexp.Regexp
+	regexes  map[string]*regexp.Regexp
+}
+
+/*
+compile validates the rule and compiles its URL patterns and regular expressions.
+*/
+func (r *Rule) compile() error {
+	if r.Domain == "" {
+		return fmt.Errorf("domain rule without domain")
+	}
+
+	if len(r.Price) == 0 {
+		return fmt.Errorf("domain rule for '%s' has no price rules", r.Domain)
+	}
+
+	r.patterns = nil
+	for _, match := range r.Match {
+		pattern, err := regexp.Compile(match)
+		if err != nil {
+			return fmt.Errorf("invalid URL pattern for '%s': %s", r.Domain, err.Error())
+		}
+
+		r.patterns = append(r.patterns, pattern)
+	}
+
+	r.regexes = map[string]*regexp.Regexp{}
+	for _, fieldRules := range [][]string{r.Name, r.Price, r.Currency, r.Availability, r.GTIN} {
+		for _, fieldRule := range fieldRules {
+			if strings.HasPrefix(fieldRule, prefixRegex) {
+				regex, err := regexp.Compile(strings.TrimPrefix(fieldRule, prefixRegex))
+				if err != nil {
+					return fmt.Errorf("invalid field rule '%s' for '%s': %s", fieldRule, r.Domain, err.Error())
+				}
+
+				r.regexes[fieldRule] = regex
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Matches checks if the given URL belongs to the domain of the rule. Without URL patterns the host of the URL has to be
+the domain or one of its subdomains.
+*/
+func (r *Rule) Matches(pageURL string) bool {
+	if len(r.patterns) > 0 {
+		for _, pattern := range r.patterns {
+			if pattern.MatchString(pageURL) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	return host == r.Domain || strings.HasSuffix(host, "."+r.Domain)
+}
+
+/*
+Extract extracts the product information from the document, fields that the rule can not find are taken from the
+structured data of the page. The currency defaults to the default currency of the money package.
+*/
+func (r *Rule) Extract(doc *goquery.Document) (*Product, error) {
+	page := &page{doc: doc}
+
+	product := &Product{
+		Name:         r.first(page, r.Name, structuredData.Name),
+		Availability: normalizeAvailability(r.first(page, r.Availability, structuredData.Availability)),
+		GTIN:         r.first(page, r.GTIN, structuredData.GTIN),
+	}
+
+	currency := r.first(page, r.Currency, structuredData.Currency)
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+
+	price := r.first(page, r.Price, structuredData.Price)
+	if price == "" {
+		return nil, fmt.Errorf("no price found on the page")
+	}
+
+	var err error
+	product.Price, err = ParsePrice(price, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+/*
+first returns the first non-empty value for the given lists of field rules.
+*/
+func (r *Rule) first(p *page, fieldRuleLists ...[]string) string {
+	for _, fieldRules := range fieldRuleLists {
+		if value := r.firstOf(p, fieldRules); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+/*
+firstOf returns the first non-empty value for the given field rules.
+*/
+func (r *Rule) firstOf(p *page, fieldRules []string) string {
+	for _, fieldRule := range fieldRules {
+		var value string
+
+		switch {
+		case strings.HasPrefix(fieldRule, prefixRegex):
+			if regex := r.regexes[fieldRule]; regex != nil {
+				value = p.regex(regex)
+			}
+		case strings.HasPrefix(fieldRule, prefixJSONLD):
+			value = p.jsonLD(strings.TrimPrefix(fieldRule, prefixJSONLD))
+		default:
+			value = p.css(strings.TrimPrefix(fieldRule, prefixCSS))
+		}
+
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// page is a parsed product page, the HTML and JSON-LD are only prepared when a field rule needs them.
+type page struct {
+	doc *goquery.Document
+
+	html     *string
+	products []map[string]interface{}
+	parsed   bool
+}
+
+/*
+css returns the text or attribute of the first element that matches the selector.
+*/
+func (p *page) css(selector string) string {
+	attribute := ""
+	if i := strings.LastIndex(selector, "@"); i >= 0 {
+		selector, attribute = selector[:i], selector[i+1:]
+	}
+
+	selection := p.doc.Find(selector).First()
+	if selection.Length() == 0 {
+		return ""
+	}
+
+	if attribute != "" {
+		return selection.AttrOr(attribute, "")
+	}
+
+	return selection.Text()
+}
+
+/*
+regex returns the first group of the regular expression on the HTML of the page, or the whole match without groups.
+*/
+func (p *page) regex(regex *regexp.Regexp) string {
+	if p.html == nil {
+		html, _ := p.doc.Html()
+		p.html = &html
+	}
+
+	match := regex.FindStringSubmatch(*p.html)
+	switch {
+	case len(match) > 1:
+		return match[1]
+	case len(match) == 1:
+		return match[0]
+	default:
+		return ""
+	}
+}
+
+/*
+jsonLD returns the value at the path in the first schema.org Product in the JSON-LD of the page.
+*/
+func (p *page) jsonLD(path string) string {
+	if !p.parsed {
+		p.products = jsonLDProducts(p.doc)
+		p.parsed = true
+	}
+
+	if len(p.products) == 0 {
+		return ""
+	}
+
+	return lookup(p.products[0], strings.Split(path, "."))
+}
@@ -0,0 +1,88 @@
+package extractor
+
+import (
+	"strings"
+)
+
+// structuredData is the rule for the schema.org Product JSON-LD and microdata and the OpenGraph product meta tags that
+// most webshops publish. It is used for domains without a rule and for the fields that a domain rule can not find.
+var structuredData = &Rule{
+	Name: []string{
+		"jsonld:name",
+		`css:[itemtype$="schema.org/Product"] [itemprop="name"]@content`,
+		`css:[itemtype$="schema.org/Product"] [itemprop="name"]`,
+		`css:meta[property="og:title"]@content`,
+	},
+	Price: []string{
+		"jsonld:offers.price",
+		"jsonld:offers.lowPrice",
+		"jsonld:offers.priceSpecification.price",
+		`css:[itemprop="price"]@content`,
+		`css:meta[property="product:price:amount"]@content`,
+		`css:meta[property="og:price:amount"]@content`,
+		`css:[itemprop="price"]`,
+	},
+	Currency: []string{
+		"jsonld:offers.priceCurrency",
+		"jsonld:offers.priceSpecification.priceCurrency",
+		`css:[itemprop="priceCurrency"]@content`,
+		`css:meta[property="product:price:currency"]@content`,
+		`css:meta[property="og:price:currency"]@content`,
+	},
+	Availability: []string{
+		"jsonld:offers.availability",
+		`css:[itemprop="availability"]@href`,
+		`css:[itemprop="availability"]@content`,
+		`css:meta[property="product:availability"]@content`,
+		`css:meta[property="og:availability"]@content`,
+	},
+	GTIN: []string{
+		"jsonld:gtin13",
+		"jsonld:gtin",
+		"jsonld:gtin14",
+		"jsonld:gtin12",
+		"jsonld:gtin8",
+		"jsonld:offers.gtin13",
+		`css:[itemprop="gtin13"]@content`,
+		`css:[itemprop="gtin"]@content`,
+		`css:meta[property="product:ean"]@content`,
+		`css:meta[property="product:upc"]@content`,
+	},
+}
+
+// availabilities links the lower case availability values of schema.org and OpenGraph to the schema.org
+// ItemAvailability names.
+var availabilities = map[string]string{
+	"instock":             "InStock",
+	"in stock":            "InStock",
+	"available":           "InStock",
+	"outofstock":          "OutOfStock",
+	"out of stock":        "OutOfStock",
+	"oos":                 "OutOfStock",
+	"soldout":             "SoldOut",
+	"preorder":            "PreOrder",
+	"pre-order":           "PreOrder",
+	"backorder":           "BackOrder",
+	"available for order": "BackOrder",
+	"discontinued":        "Discontinued",
+	"limitedavailability": "LimitedAvailability",
+	"onlineonly":          "OnlineOnly",
+	"instoreonly":         "InStoreOnly",
+}
+
+/*
+normalizeAvailability returns the schema.org ItemAvailability name for the availability, for example
+"https://schema.org/InStock" and "in stock" both become "InStock". Unknown values are returned unchanged.
+*/
+func normalizeAvailability(availability string) string {
+	name := availability
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	if normalized, ok := availabilities[strings.ToLower(name)]; ok {
+		return normalized
+	}
+
+	return availability
+}
@@ -2,30 +2,33 @@ package helper
 
 import (
 	"fmt"
-	"regexp"
+	"net/url"
 	"strings"
 
-	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/pricewatcher/internal/extractor"
+	"github.com/laetificat/pricewatcher/internal/queue"
 )
 
 // NoSupportedDomainFoundErrorMessage is the standardized error message.
 var NoSupportedDomainFoundErrorMessage = "no supported domain is found in the url"
 
+// GenericQueueName is the queue for the watchers of domains without extraction rules, their prices are taken from the
+// structured data of the product pages.
+var GenericQueueName = queue.GetNameForDomain("generic")
+
 /*
 GetSupportedDomains returns the list of supported domains.
 */
 func GetSupportedDomains() []string {
-	return watcher.SupportedDomains
+	return extractor.Domains()
 }
 
 /*
 GuessDomain returns a supported domain if it can match one with the given url.
 */
 func GuessDomain(url string) (string, error) {
-	for _, supportedDomain := range GetSupportedDomains() {
-		if matched, _ := regexp.MatchString(".*\\.?"+supportedDomain+".*", url); matched {
-			return supportedDomain, nil
-		}
+	if domain, ok := extractor.DomainForURL(url); ok {
+		return domain, nil
 	}
 
 	return "", fmt.Errorf(NoSupportedDomainFoundErrorMessage)
@@ -35,6 +38,50 @@ func GuessDomain(url string) (string, error) {
 IsSupported checks if the given domain is present in the list of supported domains.
 */
 func IsSupported(domain string) bool {
-	supportedTypes := fmt.Sprintf(",%s,", strings.Join(watcher.SupportedDomains, ","))
-	return !strings.Contains(supportedTypes, fmt.Sprintf(",%s,", domain))
+	supportedTypes := fmt.Sprintf(",%s,", strings.Join(GetSupportedDomains(), ","))
+	return strings.Contains(supportedTypes, fmt.Sprintf(",%s,", domain))
+}
+
+/*
+ResolveDomain returns the given domain, or guesses the domain from the url when no domain is given. The host of the url
+is used for domains that are not supported, without "www.".
+*/
+func ResolveDomain(pageURL, domain string) (string, error) {
+	if domain != "" {
+		return strings.ToLower(domain), nil
+	}
+
+	if guessed, err := GuessDomain(pageURL); err == nil {
+		return guessed, nil
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("no domain found in the url '%s'", pageURL)
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."), nil
+}
+
+/*
+GetQueueName returns the name of the queue for the given domain, domains that are not supported use the generic queue.
+*/
+func GetQueueName(domain string) string {
+	if IsSupported(domain) {
+		return queue.GetNameForDomain(domain)
+	}
+
+	return GenericQueueName
+}
+
+/*
+GetQueueNames returns the names of the queues for all the supported domains and the generic queue.
+*/
+func GetQueueNames() []string {
+	var names []string
+	for _, domain := range GetSupportedDomains() {
+		names = append(names, queue.GetNameForDomain(domain))
+	}
+
+	return append(names, GenericQueueName)
 }
@@ -0,0 +1,4 @@
+/*
+Package migration contains the versioned migrations of the watcher database.
+*/
+package migration
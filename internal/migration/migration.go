@@ -0,0 +1,202 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/store"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket       = []byte("meta")
+	schemaVersionKey = []byte("schema_version")
+
+	// errDryRun rolls back the transaction of a dry run.
+	errDryRun = errors.New("dry run")
+)
+
+// Migration changes the stored data from the previous schema version to its version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *bolt.Tx) error
+}
+
+// Result describes what Migrate did, or would do for a dry run.
+type Result struct {
+	From    int
+	To      int
+	Applied []Migration
+	Backup  string
+}
+
+/*
+Latest returns the schema version after all the migrations.
+*/
+func Latest() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+/*
+Version returns the schema version of the database at the given path without changing it.
+*/
+func Version(path string, timeout time.Duration) (int, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout, ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var version int
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+
+	return version, err
+}
+
+/*
+Migrate applies the pending migrations to the database at the given path in one transaction, the database is backed up
+next to the database file first. A new database gets the latest schema version without migrating.
+A dry run applies the migrations and rolls them back, so it reports if the migrations would succeed without changing
+the database or making a backup. It waits up to the timeout when another process has the database open.
+*/
+func Migrate(path string, timeout time.Duration, dryRun bool) (*Result, error) {
+	db, err := store.OpenDB(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	result := &Result{To: Latest()}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		result.From, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.From > result.To {
+		return nil, fmt.Errorf(
+			"the database has schema version %d, this version of pricewatcher supports up to version %d",
+			result.From,
+			result.To,
+		)
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > result.From {
+			result.Applied = append(result.Applied, migration)
+		}
+	}
+
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+
+	isNew, err := isEmpty(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if isNew {
+		result.Applied = nil
+		if dryRun {
+			return result, nil
+		}
+
+		return result, db.Update(func(tx *bolt.Tx) error {
+			return setSchemaVersion(tx, result.To)
+		})
+	}
+
+	if !dryRun {
+		result.Backup = fmt.Sprintf("%s.v%d-%s.bak", path, result.From, time.Now().Format("20060102150405"))
+		if err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(result.Backup, 0600)
+		}); err != nil {
+			return nil, fmt.Errorf("could not back up the database before migrating: %s", err.Error())
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, migration := range result.Applied {
+			if err := migration.Up(tx); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %s", migration.Version, migration.Description, err.Error())
+			}
+
+			if err := setSchemaVersion(tx, migration.Version); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+schemaVersion returns the schema version of the database, a database without a version has version 0.
+*/
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket(metaBucket)
+	if b == nil {
+		return 0, nil
+	}
+
+	v := b.Get(schemaVersionKey)
+	if v == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(v))
+}
+
+/*
+setSchemaVersion stores the schema version of the database.
+*/
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+}
+
+/*
+isEmpty checks if the database has no buckets, a new database does not need to be migrated.
+*/
+func isEmpty(db *bolt.DB) (bool, error) {
+	empty := true
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, _ *bolt.Bucket) error {
+			empty = false
+			return nil
+		})
+	})
+
+	return empty, err
+}
@@ -0,0 +1,346 @@
+package migration
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// migrations contains all the migrations ordered by version, a new migration is added at the end with the next
+// version and a migration can never be changed once it is released.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "convert float prices to exact amounts with a currency",
+		Up:          convertPrices,
+	},
+	{
+		Version:     2,
+		Description: "move the price histories to their own bucket",
+		Up:          movePriceHistory,
+	},
+}
+
+// The buckets and the default currency as they were when the migrations were written, the migrations do not use the
+// store and model packages so they keep working when those change.
+var (
+	watchersBucket = []byte("watchers")
+	pricesBucket   = []byte("prices")
+)
+
+const defaultCurrency = "EUR"
+
+// storedWatcher is a watcher as it is stored, by field name. A migration only decodes the fields it changes into the
+// types of its schema version, the other fields are written back as they were.
+type storedWatcher map[string]json.RawMessage
+
+// priceV0 is a price before version 1, the value is a float or a decimal string in the default currency, or already an
+// amount with a currency when it was written by a newer version without migrations.
+type priceV0 struct {
+	Value     json.RawMessage
+	Timestamp time.Time
+}
+
+// alertRuleV0 is an alert rule from version 0 on.
+type alertRuleV0 struct {
+	Type  string
+	Value float32
+}
+
+// alertV0 is a triggered alert before version 1.
+type alertV0 struct {
+	Rule      alertRuleV0
+	Price     priceV0
+	Message   string
+	Timestamp time.Time
+}
+
+// amountV1 is an exact decimal amount with its currency from version 1 on.
+type amountV1 struct {
+	Amount   string
+	Currency string
+}
+
+// priceV1 is a price from version 1 on.
+type priceV1 struct {
+	Value     amountV1
+	Timestamp time.Time
+}
+
+// alertV1 is a triggered alert from version 1 on.
+type alertV1 struct {
+	Rule      alertRuleV0
+	Price     priceV1
+	Message   string
+	Timestamp time.Time
+}
+
+/*
+convertPrices converts the prices in the price histories and the alerts of the watchers from floats to exact amounts
+with a currency.
+*/
+func convertPrices(tx *bolt.Tx) error {
+	return rewriteWatchers(tx, func(w storedWatcher) (bool, error) {
+		var history []priceV0
+		if err := w.get("PriceHistory", &history); err != nil {
+			return false, err
+		}
+
+		var alerts []alertV0
+		if err := w.get("Alerts", &alerts); err != nil {
+			return false, err
+		}
+
+		if history == nil && alerts == nil {
+			return false, nil
+		}
+
+		converted := make([]priceV1, 0, len(history))
+		for _, price := range history {
+			p, err := price.toV1()
+			if err != nil {
+				return false, err
+			}
+
+			converted = append(converted, p)
+		}
+
+		convertedAlerts := make([]alertV1, 0, len(alerts))
+		for _, alert := range alerts {
+			p, err := alert.Price.toV1()
+			if err != nil {
+				return false, err
+			}
+
+			convertedAlerts = append(convertedAlerts, alertV1{
+				Rule:      alert.Rule,
+				Price:     p,
+				Message:   alert.Message,
+				Timestamp: alert.Timestamp,
+			})
+		}
+
+		if history != nil {
+			if err := w.set("PriceHistory", converted); err != nil {
+				return false, err
+			}
+		}
+
+		if alerts != nil {
+			if err := w.set("Alerts", convertedAlerts); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+}
+
+/*
+movePriceHistory moves the price histories that were stored in the watchers to the prices bucket and sets the last and
+lowest price of the watchers.
+*/
+func movePriceHistory(tx *bolt.Tx) error {
+	prices, err := tx.CreateBucketIfNotExists(pricesBucket)
+	if err != nil {
+		return err
+	}
+
+	return rewriteWatchers(tx, func(w storedWatcher) (bool, error) {
+		var history []priceV1
+		if err := w.get("PriceHistory", &history); err != nil {
+			return false, err
+		}
+
+		if len(history) == 0 {
+			return false, nil
+		}
+
+		var id int
+		if err := w.get("ID", &id); err != nil {
+			return false, err
+		}
+
+		bucket, err := prices.CreateBucketIfNotExists(itob(id))
+		if err != nil {
+			return false, err
+		}
+
+		var last, lowest *priceV1
+		for i := range history {
+			price := history[i]
+
+			sequence, err := bucket.NextSequence()
+			if err != nil {
+				return false, err
+			}
+
+			p, err := json.Marshal(price)
+			if err != nil {
+				return false, err
+			}
+
+			if err := bucket.Put(priceKeyV2(price.Timestamp, sequence), p); err != nil {
+				return false, err
+			}
+
+			// The lowest price starts over when the currency changes.
+			if lowest == nil || lowest.Value.Currency != price.Value.Currency || price.Value.less(lowest.Value) {
+				lowest = &price
+			}
+
+			last = &price
+		}
+
+		for field, value := range map[string]interface{}{"LastPrice": last, "LowestPrice": lowest, "PriceHistory": nil} {
+			if err := w.set(field, value); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+}
+
+/*
+toV1 converts the value of the price to an exact amount, floats and strings are amounts in the default currency.
+*/
+func (p priceV0) toV1() (priceV1, error) {
+	converted := priceV1{Timestamp: p.Timestamp}
+
+	var value interface{}
+	if err := json.Unmarshal(p.Value, &value); err != nil {
+		return converted, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		converted.Value = amountV1{Amount: "0.00", Currency: defaultCurrency}
+	case float64:
+		converted.Value = amountV1{Amount: strconv.FormatFloat(math.Round(v*100)/100, 'f', 2, 64), Currency: defaultCurrency}
+	case string:
+		converted.Value = amountV1{Amount: strings.TrimSpace(v), Currency: defaultCurrency}
+	default:
+		if err := json.Unmarshal(p.Value, &converted.Value); err != nil {
+			return converted, err
+		}
+
+		if converted.Value.Currency == "" {
+			converted.Value.Currency = defaultCurrency
+		}
+	}
+
+	if _, ok := new(big.Rat).SetString(converted.Value.Amount); !ok {
+		return converted, fmt.Errorf("invalid amount '%s'", converted.Value.Amount)
+	}
+
+	return converted, nil
+}
+
+/*
+less checks if the amount is lower than the other amount, both amounts are valid decimals in the same currency.
+*/
+func (a amountV1) less(other amountV1) bool {
+	x, _ := new(big.Rat).SetString(a.Amount)
+	y, _ := new(big.Rat).SetString(other.Amount)
+	return x.Cmp(y) < 0
+}
+
+/*
+get decodes the stored field into v, v is not changed when the field is missing.
+*/
+func (w storedWatcher) get(field string, v interface{}) error {
+	value, ok := w[field]
+	if !ok {
+		return nil
+	}
+
+	if err := json.Unmarshal(value, v); err != nil {
+		return fmt.Errorf("could not read field '%s': %s", field, err.Error())
+	}
+
+	return nil
+}
+
+/*
+set encodes v as the stored field.
+*/
+func (w storedWatcher) set(field string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w[field] = value
+	return nil
+}
+
+/*
+rewriteWatchers reads every watcher, changes it with the given function and stores it again when it changed.
+*/
+func rewriteWatchers(tx *bolt.Tx, change func(w storedWatcher) (bool, error)) error {
+	b := tx.Bucket(watchersBucket)
+	if b == nil {
+		return nil
+	}
+
+	rewritten := map[string][]byte{}
+
+	err := b.ForEach(func(k, v []byte) error {
+		w := storedWatcher{}
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+
+		changed, err := change(w)
+		if err != nil || !changed {
+			return err
+		}
+
+		converted, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+
+		rewritten[string(k)] = converted
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, v := range rewritten {
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+priceKeyV2 returns the key of a price in the price history bucket of a watcher from version 2 on, the timestamp with
+the sign bit flipped so the keys sort by time followed by the sequence for prices with the same timestamp.
+*/
+func priceKeyV2(timestamp time.Time, sequence uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(timestamp.UnixNano())^(1<<63))
+	binary.BigEndian.PutUint64(key[8:], sequence)
+	return key
+}
+
+/*
+itob returns the 8-byte big endian key of a watcher ID.
+*/
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	// AlertBelow triggers when the price drops below an absolute value.
+	AlertBelow = "below"
+	// AlertDropPercent triggers when the price dropped by at least the given percentage compared to the last price.
+	AlertDropPercent = "drop_percent"
+	// AlertDropFromLow triggers when the price is at least the given percentage below the all-time low.
+	AlertDropFromLow = "drop_from_low"
+	// AlertNewLow triggers when the price is lower than all the previous prices.
+	AlertNewLow = "new_low"
+)
+
+// AlertRule is a condition on a new price that triggers an alert. The value is the percentage of the percent rules and
+// the amount is the exact decimal amount of the below rule in the currency of the price, like "99.95". Rules ignore
+// the fields they do not need.
+type AlertRule struct {
+	Type   string
+	Value  float32
+	Amount string
+}
+
+/*
+UnmarshalJSON reads an alert rule, below rules that were stored with the amount as a float value get it as a decimal
+amount.
+*/
+func (r *AlertRule) UnmarshalJSON(data []byte) error {
+	type storedRule AlertRule
+
+	rule := storedRule{}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return err
+	}
+
+	if rule.Type == AlertBelow && rule.Amount == "" && rule.Value != 0 {
+		rule.Amount = strconv.FormatFloat(float64(rule.Value), 'f', -1, 32)
+		rule.Value = 0
+	}
+
+	*r = AlertRule(rule)
+	return nil
+}
+
+// Alert is a triggered alert rule for a price.
+type Alert struct {
+	Rule      AlertRule
+	Price     Price
+	Message   string
+	Timestamp time.Time
+}
@@ -0,0 +1,8 @@
+package model
+
+// Collection is a named group of watchers, it contains the watchers that have at least one of its tags.
+type Collection struct {
+	Name        string
+	Description string
+	Tags        []string
+}
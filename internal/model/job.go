@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Job is a watcher in a queue together with the amount of times it has been handed out to a worker and the last error
+// a worker reported for it.
+type Job struct {
+	Watcher
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+// Lease is a job that is handed out to a worker, the job is queued again when it is not acknowledged before the deadline.
+type Lease struct {
+	Job
+	LeaseID       string
+	LeaseDeadline time.Time
+}
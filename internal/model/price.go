@@ -1,9 +1,35 @@
 package model
 
-import "time"
+import (
+	"time"
 
-// Price is a single price object that has links a value with a timestamp.
+	"github.com/laetificat/pricewatcher/internal/money"
+)
+
+// Price is a single price object that has links a value with a timestamp, the value carries its currency.
 type Price struct {
-	Value     float32
+	Value     money.Money
 	Timestamp time.Time
 }
+
+// PriceBucket summarizes the prices in a period of a downsampled price history, from the start up to the end.
+type PriceBucket struct {
+	Start   time.Time
+	End     time.Time
+	Count   int
+	Min     money.Money
+	Max     money.Money
+	Average money.Money
+	Last    money.Money
+}
+
+// PriceStats summarizes a price history, the fields are nil when there are no prices to compute them from. The change
+// is the percentage the price changed from the first to the last price in the requested period.
+type PriceStats struct {
+	Current       *Price
+	Low           *Price
+	High          *Price
+	Average30Days *money.Money
+	Average90Days *money.Money
+	Change        *float64
+}
@@ -1,8 +1,10 @@
 package model
 
-// Update request model links an id to a price object to add.
+// Update request model links an id to a price object to add, the availability and GTIN are optional.
 type Update struct {
-	ID    int
-	Name  string
-	Price Price
+	ID           int
+	Name         string
+	Availability string
+	GTIN         string
+	Price        Price
 }
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// User is an account of the webserver, it authenticates with a bearer token of which only the SHA-256 hash is stored.
+// Admin users see and change all the watchers, other users only the watchers they are subscribed to.
+type User struct {
+	Name      string
+	TokenHash string
+	Admin     bool
+	Created   time.Time
+}
@@ -2,13 +2,47 @@ package model
 
 import "time"
 
-// Watcher contains metadata and a list of prices.
+// Watcher contains metadata, the last and lowest price and a list of prices. The price history is stored separately
+// and is only filled when it is requested. A watcher is shared by the users that are subscribed to it, so every URL is
+// only checked once, the name, tags and alert rules of a subscriber are kept in its subscription. A name that was set
+// by an admin is marked as custom so it is not replaced by the name on the product page.
 type Watcher struct {
 	ID           int
 	Name         string
+	CustomName   bool
 	URL          string
 	Domain       string
+	Availability string
+	GTIN         string
+	Tags         []string
+	Subscribers  []Subscription
 	LastChecked  time.Time
 	IsChecking   bool
+	LastPrice    *Price
+	LowestPrice  *Price
 	PriceHistory []Price
+	AlertRules   []AlertRule
+	Alerts       []Alert
+}
+
+// Subscription is a user that is subscribed to a shared watcher with the settings of that user: the name the user sees
+// instead of the name of the watcher when it is set, the tags, and the alert rules with the alerts they triggered.
+type Subscription struct {
+	User       string
+	Name       string
+	Tags       []string
+	AlertRules []AlertRule
+	Alerts     []Alert
+}
+
+/*
+SubscriberNames returns the names of the users that are subscribed to the watcher.
+*/
+func (w *Watcher) SubscriberNames() []string {
+	names := make([]string, 0, len(w.Subscribers))
+	for _, subscription := range w.Subscribers {
+		names = append(names, subscription.User)
+	}
+
+	return names
 }
@@ -0,0 +1,59 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exponents contains the ISO 4217 currencies that do not have two decimals.
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0,
+	"UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// symbols links the currency symbols that shops show on their pages to their ISO 4217 code.
+var symbols = map[string]string{
+	"€":   "EUR",
+	"$":   "USD",
+	"US$": "USD",
+	"£":   "GBP",
+	"¥":   "JPY",
+	"CHF": "CHF",
+	"KR":  "SEK",
+	"ZŁ":  "PLN",
+}
+
+/*
+Exponent returns the amount of decimals of the currency.
+*/
+func Exponent(currency string) int {
+	if exponent, ok := exponents[currency]; ok {
+		return exponent
+	}
+
+	return 2
+}
+
+/*
+NormalizeCurrency returns the ISO 4217 code for the currency code or symbol, for example "eur" and "€" both return
+"EUR".
+*/
+func NormalizeCurrency(currency string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if symbol, ok := symbols[code]; ok {
+		return symbol, nil
+	}
+
+	if len(code) != 3 {
+		return "", fmt.Errorf("unknown currency '%s'", currency)
+	}
+
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("unknown currency '%s'", currency)
+		}
+	}
+
+	return code, nil
+}
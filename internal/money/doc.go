@@ -0,0 +1,4 @@
+/*
+Package money contains the exact money type that is used for prices.
+*/
+package money
@@ -0,0 +1,234 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of prices that were stored or reported without a currency.
+const DefaultCurrency = "EUR"
+
+// Money is an exact amount of money in the minor unit of its ISO 4217 currency, for example an amount of 1999 in EUR is
+// €19.99. In JSON the amount is written as an exact decimal string: {"Amount": "19.99", "Currency": "EUR"}.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+/*
+New returns the amount in the minor unit of the currency.
+*/
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+/*
+Parse parses a decimal amount like "19.99" or "-5" in the given currency, amounts with more decimals than the
+currency has are rounded half away from zero.
+*/
+func Parse(value, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := strings.TrimSpace(value)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("invalid amount '%s'", value)
+	}
+
+	exponent := Exponent(currency)
+	roundUp := len(fraction) > exponent && fraction[exponent] >= '5'
+	if len(fraction) > exponent {
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt("0"+whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount '%s': %s", value, err.Error())
+	}
+
+	if roundUp {
+		amount++
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+/*
+FromFloat returns the float amount in the given currency rounded to the minor unit of the currency, it should only be
+used for amounts that were stored as floats.
+*/
+func FromFloat(value float64, currency string) Money {
+	return Money{
+		Amount:   int64(math.Round(value * math.Pow10(Exponent(currency)))),
+		Currency: currency,
+	}
+}
+
+/*
+Decimal returns the amount as an exact decimal string, for example "19.99".
+*/
+func (m Money) Decimal() string {
+	exponent := Exponent(m.Currency)
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+/*
+Float64 returns the amount as a float, it is only meant for calculations like percentages.
+*/
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+/*
+String returns the amount with its currency, for example "19.99 EUR".
+*/
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+
+	return m.Decimal() + " " + m.Currency
+}
+
+/*
+SameCurrency checks if both amounts are in the same currency so they can be compared.
+*/
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+/*
+Less checks if the amount is less than the other amount, both amounts need to be in the same currency.
+*/
+func (m Money) Less(other Money) bool {
+	return m.Amount < other.Amount
+}
+
+/*
+Convert returns the amount converted to the given currency, rate is the amount of the other currency for one unit of
+the currency of the amount. The result is rounded half away from zero to the minor unit of the other currency.
+*/
+func (m Money) Convert(currency string, rate *big.Rat) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(Exponent(m.Currency)))
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetInt(pow10(Exponent(currency))))
+
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: currency}
+}
+
+/*
+MarshalJSON writes the amount as an exact decimal string with its currency.
+*/
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string
+		Currency string
+	}{m.Decimal(), m.Currency})
+}
+
+/*
+UnmarshalJSON reads an amount written by MarshalJSON. Amounts that were stored as a plain number or string, before
+prices had a currency, are read in the default currency.
+*/
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case float64:
+		*m = FromFloat(v, DefaultCurrency)
+		return nil
+	case string:
+		parsed, err := Parse(v, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+
+		*m = parsed
+		return nil
+	}
+
+	stored := struct {
+		Amount   string
+		Currency string
+	}{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	if stored.Currency == "" {
+		stored.Currency = DefaultCurrency
+	}
+
+	parsed, err := Parse(stored.Amount, stored.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+/*
+pow10 returns 10 to the power of n.
+*/
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+/*
+isDigits checks if the string only contains the digits 0 to 9.
+*/
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,4 @@
+/*
+Package notifier contains all the code for sending notifications about price changes.
+*/
+package notifier
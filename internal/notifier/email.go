@@ -0,0 +1,133 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/spf13/viper"
+)
+
+// Email sends an HTML email rendered from a template over SMTP.
+type Email struct {
+	Addresses []string
+	Template  string
+	From      string
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+}
+
+// emailTemplateData is the data that is passed to the email template.
+type emailTemplateData struct {
+	Type     string
+	Watcher  *model.Watcher
+	Previous *model.Price
+	Current  model.Price
+	Alert    *model.Alert
+}
+
+/*
+newEmail returns an email notifier configured with the [notification.email] config section.
+*/
+func newEmail() Notifier {
+	return &Email{
+		Addresses: viper.GetStringSlice("notification.email.addresses"),
+		Template:  viper.GetString("notification.email.template"),
+		From:      viper.GetString("notification.email.from"),
+		Host:      viper.GetString("notification.email.smtp.host"),
+		Port:      viper.GetString("notification.email.smtp.port"),
+		Username:  viper.GetString("notification.email.smtp.username"),
+		Password:  viper.GetString("notification.email.smtp.password"),
+	}
+}
+
+/*
+Name returns the name of the notifier.
+*/
+func (e *Email) Name() string {
+	return "email"
+}
+
+/*
+Notify renders the template and sends it to all the addresses.
+*/
+func (e *Email) Notify(event *Event) error {
+	if len(e.Addresses) == 0 {
+		return fmt.Errorf("no addresses configured for email notifications")
+	}
+
+	body, err := e.render(emailTemplateData{
+		Type:     event.Type,
+		Watcher:  event.Watcher,
+		Previous: event.Previous,
+		Current:  event.Current,
+		Alert:    event.Alert,
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("Price update for %s", watcherTitle(event.Watcher))
+	switch event.Type {
+	case EventPriceDropped:
+		subject = fmt.Sprintf("Price drop for %s", watcherTitle(event.Watcher))
+	case EventAlertTriggered:
+		subject = fmt.Sprintf("Price alert for %s", watcherTitle(event.Watcher))
+	}
+
+	return e.send(e.buildMessage(subject, body))
+}
+
+/*
+render parses the HTML template file and executes it with the given data.
+*/
+func (e *Email) render(data emailTemplateData) ([]byte, error) {
+	tmpl, err := template.ParseFiles(e.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := tmpl.Execute(buffer, data); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+/*
+buildMessage creates an RFC 822 formatted HTML message. The subject has the scraped name of the product, so line breaks
+are removed and other characters are encoded to keep the page from adding headers.
+*/
+func (e *Email) buildMessage(subject string, body []byte) []byte {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(fmt.Sprintf("From: %s\r\n", e.From))
+	buffer.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(e.Addresses, ", ")))
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	buffer.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject)))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	buffer.WriteString("\r\n")
+	buffer.Write(body)
+
+	return buffer.Bytes()
+}
+
+/*
+send sends the message over SMTP, authentication is only used when a username is configured.
+*/
+func (e *Email) send(message []byte) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(e.Host, e.Port), auth, e.From, e.Addresses, message)
+}
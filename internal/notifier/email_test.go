@@ -0,0 +1,165 @@
+package notifier
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/pricewatcher/internal/testutil"
+)
+
+func TestEmailNotify(t *testing.T) {
+	previous := model.Price{Value: money.New(1999, "EUR")}
+	current := model.Price{Value: money.New(1499, "EUR")}
+
+	tests := []struct {
+		name        string
+		event       *Event
+		addresses   []string
+		wantSubject string
+		wantBody    string
+		wantErr     bool
+	}{
+		{
+			name: "price updated",
+			event: &Event{
+				Type:    EventPriceUpdated,
+				Watcher: &model.Watcher{Name: "Kettle", URL: "https://shop.example/kettle"},
+				Current: current,
+			},
+			addresses:   []string{"alice@example.com"},
+			wantSubject: "Price update for Kettle",
+			wantBody:    "Kettle https://shop.example/kettle 14.99 EUR",
+		},
+		{
+			name: "price dropped to several addresses",
+			event: &Event{
+				Type:     EventPriceDropped,
+				Watcher:  &model.Watcher{Name: "Kettle", URL: "https://shop.example/kettle"},
+				Previous: &previous,
+				Current:  current,
+			},
+			addresses:   []string{"alice@example.com", "bob@example.com"},
+			wantSubject: "Price drop for Kettle",
+			wantBody:    "Kettle https://shop.example/kettle 14.99 EUR",
+		},
+		{
+			name: "watcher without a name",
+			event: &Event{
+				Type:     EventPriceDropped,
+				Watcher:  &model.Watcher{URL: "https://shop.example/kettle"},
+				Previous: &previous,
+				Current:  current,
+			},
+			addresses:   []string{"alice@example.com"},
+			wantSubject: "Price drop for https://shop.example/kettle",
+			wantBody:    " https://shop.example/kettle 14.99 EUR",
+		},
+		{
+			name: "alert triggered",
+			event: &Event{
+				Type:    EventAlertTriggered,
+				Watcher: &model.Watcher{Name: "Kettle", URL: "https://shop.example/kettle"},
+				Current: current,
+				Alert:   &model.Alert{Message: "below 15.00"},
+			},
+			addresses:   []string{"alice@example.com"},
+			wantSubject: "Price alert for Kettle",
+			wantBody:    "Kettle https://shop.example/kettle 14.99 EUR",
+		},
+		{
+			name: "line breaks in the name do not add headers",
+			event: &Event{
+				Type:    EventPriceUpdated,
+				Watcher: &model.Watcher{Name: "Kettle\r\nBcc: mallory@example.com", URL: "https://shop.example/kettle"},
+				Current: current,
+			},
+			addresses:   []string{"alice@example.com"},
+			wantSubject: "Price update for Kettle  Bcc: mallory@example.com",
+			wantBody:    "https://shop.example/kettle 14.99 EUR",
+		},
+		{
+			name: "no addresses",
+			event: &Event{
+				Type:    EventPriceUpdated,
+				Watcher: &model.Watcher{Name: "Kettle", URL: "https://shop.example/kettle"},
+				Current: current,
+			},
+			wantErr: true,
+		},
+	}
+
+	template, removeTemplate := testutil.WriteFile(
+		t,
+		"notification.html",
+		"{{.Watcher.Name}} {{.Watcher.URL}} {{.Current.Value}}",
+	)
+	defer removeTemplate()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := testutil.StartSMTP(t)
+			defer server.Close()
+
+			email := &Email{
+				Addresses: tt.addresses,
+				Template:  template,
+				From:      "pricewatcher@example.com",
+				Host:      server.Host,
+				Port:      server.Port,
+			}
+
+			err := email.Notify(tt.event)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received := <-server.Messages
+
+			if received.From != email.From {
+				t.Errorf("expected the message from '%s', got '%s'", email.From, received.From)
+			}
+
+			if strings.Join(received.To, ",") != strings.Join(tt.addresses, ",") {
+				t.Errorf("expected the message to %v, got %v", tt.addresses, received.To)
+			}
+
+			message, err := mail.ReadMessage(strings.NewReader(received.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bcc := message.Header.Get("Bcc"); bcc != "" {
+				t.Errorf("expected no Bcc header, got '%s'", bcc)
+			}
+
+			subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if subject != tt.wantSubject {
+				t.Errorf("expected subject '%s', got '%s'", tt.wantSubject, subject)
+			}
+
+			body, err := ioutil.ReadAll(message.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("expected the body to contain '%s', got '%s'", tt.wantBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EventPriceUpdated is the event type for every new price that is recorded.
+	EventPriceUpdated = "price_updated"
+	// EventPriceDropped is the event type for a new price that is lower than the previous price.
+	EventPriceDropped = "price_dropped"
+	// EventAlertTriggered is the event type for an alert rule of a watcher that triggered.
+	EventAlertTriggered = "alert_triggered"
+)
+
+// Event is a price event for a watcher that notifiers can send a notification for.
+type Event struct {
+	Type     string
+	Watcher  *model.Watcher
+	Previous *model.Price
+	Current  model.Price
+	Alert    *model.Alert
+}
+
+// Notifier is a backend that can send a notification for an event.
+type Notifier interface {
+	Name() string
+	Notify(event *Event) error
+}
+
+// backends links the name of a backend, which is also the config section name, to its constructor.
+var backends = map[string]func() Notifier{
+	"email":   newEmail,
+	"webhook": newWebhook,
+	"slack":   newSlack,
+	"stdout":  newStdout,
+}
+
+/*
+Enabled returns all the notifiers that are enabled in the [notification.<name>] config sections.
+*/
+func Enabled() []Notifier {
+	var notifiers []Notifier
+	for name, constructor := range backends {
+		if viper.GetBool(configKey(name, "enabled")) {
+			notifiers = append(notifiers, constructor())
+		}
+	}
+
+	return notifiers
+}
+
+/*
+Dispatch sends the event to all the enabled notifiers that are subscribed to the event type, failures are logged and
+never returned so a failing backend does not affect the others.
+*/
+func Dispatch(event *Event) {
+	for _, n := range Enabled() {
+		if !isSubscribed(n.Name(), event.Type) {
+			continue
+		}
+
+		slogger.Debug(fmt.Sprintf("Sending '%s' notification with notifier '%s'", event.Type, n.Name()))
+		if err := n.Notify(event); err != nil {
+			slogger.Error(fmt.Sprintf("notifier '%s' could not send '%s' notification: %s", n.Name(), event.Type, err.Error()))
+		}
+	}
+}
+
+/*
+isSubscribed checks if the notifier with the given name should be notified of the given event type, notifiers are
+only subscribed to price drops and alerts unless configured otherwise.
+*/
+func isSubscribed(name, eventType string) bool {
+	events := viper.GetStringSlice(configKey(name, "events"))
+	if len(events) == 0 {
+		events = []string{EventPriceDropped, EventAlertTriggered}
+	}
+
+	for _, v := range events {
+		if v == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+configKey returns the config key for the given backend and option.
+*/
+func configKey(name, option string) string {
+	return fmt.Sprintf("notification.%s.%s", name, option)
+}
+
+/*
+describe returns a short human readable description of the event.
+*/
+func describe(event *Event) string {
+	title := watcherTitle(event.Watcher)
+
+	switch {
+	case event.Type == EventAlertTriggered && event.Alert != nil:
+		return fmt.Sprintf("Alert for %s, %s: %s", title, event.Alert.Message, event.Watcher.URL)
+	case event.Type == EventPriceDropped && event.Previous != nil:
+		return fmt.Sprintf(
+			"The price of %s dropped from %s to %s: %s",
+			title,
+			event.Previous.Value,
+			event.Current.Value,
+			event.Watcher.URL,
+		)
+	default:
+		return fmt.Sprintf("The price of %s is %s: %s", title, event.Current.Value, event.Watcher.URL)
+	}
+}
+
+/*
+watcherTitle returns the name of the watcher, or the URL if the watcher has no name yet.
+*/
+func watcherTitle(watcher *model.Watcher) string {
+	if watcher.Name != "" {
+		return watcher.Name
+	}
+
+	return watcher.URL
+}
@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/viper"
+)
+
+// Slack posts a message to a Slack or Mattermost compatible incoming webhook.
+type Slack struct {
+	URL      string
+	Channel  string
+	Username string
+	client   *http.Client
+}
+
+// slackPayload is the incoming webhook body understood by both Slack and Mattermost.
+type slackPayload struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+/*
+newSlack returns a Slack notifier configured with the [notification.slack] config section.
+*/
+func newSlack() Notifier {
+	return &Slack{
+		URL:      viper.GetString("notification.slack.url"),
+		Channel:  viper.GetString("notification.slack.channel"),
+		Username: viper.GetString("notification.slack.username"),
+		client:   &http.Client{Timeout: viper.GetDuration("notification.slack.timeout")},
+	}
+}
+
+/*
+Name returns the name of the notifier.
+*/
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+/*
+Notify posts a description of the event to the incoming webhook.
+*/
+func (s *Slack) Notify(event *Event) error {
+	body, err := json.Marshal(slackPayload{
+		Text:     describe(event),
+		Channel:  s.Channel,
+		Username: s.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	return postRequest(s.client, request)
+}
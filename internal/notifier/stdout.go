@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+)
+
+// Stdout writes a description of the event to a writer or the log, this is mostly useful during development.
+type Stdout struct {
+	UseLog bool
+	writer io.Writer
+}
+
+/*
+newStdout returns a stdout notifier configured with the [notification.stdout] config section.
+*/
+func newStdout() Notifier {
+	return &Stdout{
+		UseLog: viper.GetBool("notification.stdout.log"),
+		writer: os.Stdout,
+	}
+}
+
+/*
+Name returns the name of the notifier.
+*/
+func (s *Stdout) Name() string {
+	return "stdout"
+}
+
+/*
+Notify writes the description of the event to the log or the writer.
+*/
+func (s *Stdout) Notify(event *Event) error {
+	message := fmt.Sprintf("[%s] %s", event.Type, describe(event))
+
+	if s.UseLog {
+		slogger.Info(message)
+		return nil
+	}
+
+	_, err := fmt.Fprintln(s.writer, message)
+	return err
+}
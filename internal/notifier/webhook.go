@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/spf13/viper"
+)
+
+// SignatureHeader is the header that contains the HMAC-SHA256 signature of the webhook body.
+const SignatureHeader = "X-Pricewatcher-Signature"
+
+// Webhook posts the event as JSON to a URL, signed with a shared secret.
+type Webhook struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+// webhookPayload is the JSON body that is posted to the webhook URL.
+type webhookPayload struct {
+	Event     string         `json:"event"`
+	Message   string         `json:"message"`
+	Watcher   *model.Watcher `json:"watcher"`
+	Previous  *model.Price   `json:"previous"`
+	Current   model.Price    `json:"current"`
+	Alert     *model.Alert   `json:"alert,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+/*
+newWebhook returns a webhook notifier configured with the [notification.webhook] config section.
+*/
+func newWebhook() Notifier {
+	return &Webhook{
+		URL:    viper.GetString("notification.webhook.url"),
+		Secret: viper.GetString("notification.webhook.secret"),
+		client: &http.Client{Timeout: viper.GetDuration("notification.webhook.timeout")},
+	}
+}
+
+/*
+Name returns the name of the notifier.
+*/
+func (wh *Webhook) Name() string {
+	return "webhook"
+}
+
+/*
+Notify posts the event to the webhook URL, the body is signed when a secret is configured.
+*/
+func (wh *Webhook) Notify(event *Event) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:     event.Type,
+		Message:   describe(event),
+		Watcher:   event.Watcher,
+		Previous:  event.Previous,
+		Current:   event.Current,
+		Alert:     event.Alert,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	if wh.Secret != "" {
+		request.Header.Set(SignatureHeader, "sha256="+Sign(wh.Secret, body))
+	}
+
+	return postRequest(wh.client, request)
+}
+
+/*
+Sign returns the hex encoded HMAC-SHA256 of the body using the given secret.
+*/
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+postRequest executes the request and returns an error when the response status code is not a success code.
+*/
+func postRequest(client *http.Client, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("posting to '%s' failed, status code %d", request.URL.String(), response.StatusCode)
+	}
+
+	return nil
+}
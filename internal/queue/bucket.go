@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucketNames are the top level buckets, each of them contains a bucket for every queue.
+var bucketNames = struct {
+	jobs, leases, dead []byte
+}{[]byte("queues"), []byte("leases"), []byte("dead")}
+
+// buckets contains the buckets of a single queue.
+type buckets struct {
+	jobs, leases, dead *bolt.Bucket
+}
+
+/*
+requeueExpired queues the jobs of all the leases that expired before the given time again.
+*/
+func requeueExpired(b *buckets, now time.Time) error {
+	expired, err := leasesWhere(b.leases, func(lease *model.Lease) bool {
+		return !lease.LeaseDeadline.After(now)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, lease := range expired {
+		slogger.Info(fmt.Sprintf("Lease '%s' for watcher %d expired", lease.LeaseID, lease.ID))
+
+		if err := b.leases.Delete([]byte(lease.LeaseID)); err != nil {
+			return err
+		}
+
+		lease.LastError = fmt.Sprintf("lease expired at %s", lease.LeaseDeadline.Format(time.RFC3339))
+		if err := retry(b, &lease.Job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+leasesWhere returns all the leases in the bucket that match the given function, the bucket is not modified while
+iterating so the caller can safely delete the returned leases.
+*/
+func leasesWhere(bucket *bolt.Bucket, match func(lease *model.Lease) bool) ([]*model.Lease, error) {
+	var leases []*model.Lease
+
+	err := bucket.ForEach(func(k, v []byte) error {
+		lease := &model.Lease{}
+		if err := json.Unmarshal(v, lease); err != nil {
+			return err
+		}
+
+		if match(lease) {
+			leases = append(leases, lease)
+		}
+
+		return nil
+	})
+
+	return leases, err
+}
+
+/*
+retry queues the job again, or moves it to the dead-letter queue when it reached the maximum amount of attempts.
+*/
+func retry(b *buckets, job *model.Job) error {
+	if job.Attempts >= viper.GetInt("queue.max_attempts") {
+		slogger.Error(fmt.Sprintf(
+			"Job for watcher %d failed %d times, moving it to the dead-letter queue, last error: %s",
+			job.ID,
+			job.Attempts,
+			job.LastError,
+		))
+
+		job.FailedAt = time.Now()
+		return push(b.dead, job)
+	}
+
+	return push(b.jobs, job)
+}
+
+/*
+removeDead removes the job for the watcher with the given ID from the dead-letter queue and returns it.
+*/
+func removeDead(b *buckets, watcherID int) (*model.Job, error) {
+	var key []byte
+	job := &model.Job{}
+
+	err := b.dead.ForEach(func(k, v []byte) error {
+		if key != nil {
+			return nil
+		}
+
+		if err := json.Unmarshal(v, job); err != nil {
+			return err
+		}
+
+		if job.ID == watcherID {
+			key = k
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		return nil, ErrJobNotFound
+	}
+
+	return job, b.dead.Delete(key)
+}
+
+/*
+allJobs returns all the jobs in the bucket.
+*/
+func allJobs(bucket *bolt.Bucket) ([]*model.Job, error) {
+	var jobs []*model.Job
+
+	err := bucket.ForEach(func(k, v []byte) error {
+		job := &model.Job{}
+		if err := json.Unmarshal(v, job); err != nil {
+			return err
+		}
+
+		jobs = append(jobs, job)
+		return nil
+	})
+
+	return jobs, err
+}
+
+/*
+push appends the job to the end of the bucket.
+*/
+func push(bucket *bolt.Bucket, job *model.Job) error {
+	j, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(itob(id), j)
+}
+
+/*
+containsWatcher checks if the bucket contains a job or lease for the watcher with the given ID.
+*/
+func containsWatcher(bucket *bolt.Bucket, watcherID int) (bool, error) {
+	c := bucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		job := model.Job{}
+		if err := json.Unmarshal(v, &job); err != nil {
+			return false, err
+		}
+
+		if job.ID == watcherID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+/*
+newLeaseID returns a random hex encoded lease ID.
+*/
+func newLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+/*
+itob transforms an uint64 to a binary representation for BoltDB
+*/
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
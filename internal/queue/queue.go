@@ -1,91 +1,340 @@
 package queue
 
 import (
-	"container/list"
+	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
+	"github.com/laetificat/pricewatcher/internal/events"
 	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/spf13/viper"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// ErrLeaseNotFound is returned when a lease does not exist, it was already acknowledged or it expired.
+	ErrLeaseNotFound = fmt.Errorf("lease not found")
+	// ErrJobNotFound is returned when the dead-letter queue has no job for a watcher.
+	ErrJobNotFound = fmt.Errorf("job not found")
 )
 
-var queues = map[string]*list.List{}
+// Queue is a persistent queue of watcher jobs, it is safe for concurrent use and every job is handed out only once
+// until its lease expires or it is reported as failed.
+type Queue struct {
+	name string
+	db   *bolt.DB
+	mu   sync.Mutex
+
+	// ready is closed and replaced when jobs become available to wake up the callers of NextWait.
+	ready   chan struct{}
+	readyMu sync.Mutex
+}
+
+/*
+newQueue returns a queue with the given name that stores its jobs in the given database.
+*/
+func newQueue(name string, db *bolt.DB) *Queue {
+	return &Queue{name: name, db: db, ready: make(chan struct{})}
+}
 
 /*
-ListQueues returns a list of queues that are currently registered.
+Name returns the name of the queue.
 */
-func ListQueues() map[string]*list.List {
-	return queues
+func (q *Queue) Name() string {
+	return q.name
 }
 
 /*
-Get returns a list of items in a queue with the given name.
+Jobs returns the jobs that are waiting in the queue, jobs with an expired lease are queued again first.
 */
-func Get(queueName string) ([]*model.Watcher, error) {
-	var watchers []*model.Watcher
-	if queue, ok := queues[queueName]; ok {
-		for e := queue.Front(); e != nil; e = e.Next() {
-			watchers = append(watchers, e.Value.(*model.Watcher))
+func (q *Queue) Jobs() ([]*model.Job, error) {
+	var jobs []*model.Job
+
+	err := q.update(func(b *buckets) error {
+		if err := requeueExpired(b, time.Now()); err != nil {
+			return err
 		}
 
-		return watchers, nil
-	}
+		var err error
+		jobs, err = allJobs(b.jobs)
+		return err
+	})
 
-	return nil, fmt.Errorf("could not find queue '%s'", queueName)
+	return jobs, err
 }
 
 /*
-Add adds the given watcher to the queue with the given name.
+Add adds the given watcher to the queue, the watcher is not added if the queue already contains a job or an active
+lease for a watcher with the same ID, or when the watcher is in the dead-letter queue.
 */
-func Add(queueName string, watcher *model.Watcher) error {
-	if queue, ok := queues[queueName]; ok {
-		for e := queue.Front(); e != nil; e = e.Next() {
-			if e.Value.(*model.Watcher).ID == watcher.ID {
+func (q *Queue) Add(watcher *model.Watcher) error {
+	added := false
+
+	err := q.updateAndWake(func(b *buckets) error {
+		for _, bucket := range []*bolt.Bucket{b.jobs, b.leases, b.dead} {
+			found, err := containsWatcher(bucket, watcher.ID)
+			if err != nil {
+				return err
+			}
+
+			if found {
 				return nil
 			}
 		}
 
-		queue.PushBack(watcher)
-		return nil
+		added = true
+		return push(b.jobs, &model.Job{Watcher: *watcher})
+	})
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("could not find queue '%s'", queueName)
+	if added {
+		events.Publish(events.JobQueued, watcher.SubscriberNames(), struct {
+			Queue     string `json:"queue"`
+			WatcherID int    `json:"watcher_id"`
+		}{q.name, watcher.ID})
+	}
+
+	return nil
 }
 
 /*
-Next returns the first item from the queue the front with the given name, when returning it also removes it from the queue.
+Next hands out the first job from the queue as a lease, the job is removed from the queue and has to be acknowledged
+with Ack before the lease deadline or it is queued again. Returns nil if the queue is empty.
 */
-func Next(name string) (*model.Watcher, error) {
-	if queue, ok := queues[name]; ok {
-		if queue.Front() != nil {
-			queueElement := queue.Front()
-			queue.Remove(queueElement)
-			return queueElement.Value.(*model.Watcher), nil
+func (q *Queue) Next() (*model.Lease, error) {
+	var lease *model.Lease
+
+	err := q.update(func(b *buckets) error {
+		now := time.Now()
+		if err := requeueExpired(b, now); err != nil {
+			return err
+		}
+
+		c := b.jobs.Cursor()
+		k, v := c.First()
+		if k == nil {
+			return nil
 		}
 
-		return nil, nil
+		job := model.Job{}
+		if err := json.Unmarshal(v, &job); err != nil {
+			return err
+		}
+
+		if err := c.Delete(); err != nil {
+			return err
+		}
+
+		leaseID, err := newLeaseID()
+		if err != nil {
+			return err
+		}
+
+		job.Attempts++
+		lease = &model.Lease{
+			Job:           job,
+			LeaseID:       leaseID,
+			LeaseDeadline: now.Add(viper.GetDuration("queue.lease_timeout")),
+		}
+
+		l, err := json.Marshal(lease)
+		if err != nil {
+			return err
+		}
+
+		return b.leases.Put([]byte(leaseID), l)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if lease != nil {
+		events.Publish(events.JobLeased, lease.SubscriberNames(), struct {
+			Queue         string    `json:"queue"`
+			WatcherID     int       `json:"watcher_id"`
+			LeaseID       string    `json:"lease_id"`
+			LeaseDeadline time.Time `json:"lease_deadline"`
+		}{q.name, lease.ID, lease.LeaseID, lease.LeaseDeadline})
 	}
 
-	return nil, fmt.Errorf("could not find queue with name '%s'", name)
+	return lease, nil
 }
 
 /*
-GetNameForDomain returns a queue equivalent name for the given domain.
-It prepends "queue_" to the given domain and replaces "." with "_".
+NextWait hands out the first job from the queue as a lease like Next, but when the queue is empty it waits until a job
+is added or the context is done. Returns nil if no job became available in time.
 */
-func GetNameForDomain(domain string) string {
-	return "queue_" + strings.ReplaceAll(domain, ".", "_")
+func (q *Queue) NextWait(ctx context.Context) (*model.Lease, error) {
+	for {
+		// The channel is taken before checking the queue so a job that is added in between is not missed.
+		ready := q.readyChannel()
+
+		lease, err := q.Next()
+		if err != nil || lease != nil {
+			return lease, err
+		}
+
+		// Expired leases are only queued again when the queue is checked, so check again every now and then.
+		timer := time.NewTimer(time.Second)
+
+		select {
+		case <-ready:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		}
+
+		timer.Stop()
+	}
 }
 
 /*
-Create creates a new queue with the given name if it does not exist.
+Ack acknowledges that the job of the lease was processed, the lease is removed and the job will not be queued again.
 */
-func Create(domain ...string) error {
-	for _, v := range domain {
-		if _, ok := queues[v]; ok {
-			return fmt.Errorf("queue with name '%s' already exists", v)
+func (q *Queue) Ack(leaseID string) error {
+	return q.update(func(b *buckets) error {
+		if b.leases.Get([]byte(leaseID)) == nil {
+			return ErrLeaseNotFound
 		}
-		queues[v] = list.New()
+
+		return b.leases.Delete([]byte(leaseID))
+	})
+}
+
+/*
+Nack reports that the job of the lease failed with the given reason, the job is queued again or moved to the
+dead-letter queue when it reached the maximum amount of attempts.
+*/
+func (q *Queue) Nack(leaseID, reason string) error {
+	return q.updateAndWake(func(b *buckets) error {
+		v := b.leases.Get([]byte(leaseID))
+		if v == nil {
+			return ErrLeaseNotFound
+		}
+
+		lease := model.Lease{}
+		if err := json.Unmarshal(v, &lease); err != nil {
+			return err
+		}
+
+		if err := b.leases.Delete([]byte(leaseID)); err != nil {
+			return err
+		}
+
+		lease.LastError = reason
+		return retry(b, &lease.Job)
+	})
+}
+
+/*
+AckWatcher acknowledges all the leases for the watcher with the given ID.
+*/
+func (q *Queue) AckWatcher(watcherID int) error {
+	return q.update(func(b *buckets) error {
+		leases, err := leasesWhere(b.leases, func(lease *model.Lease) bool {
+			return lease.ID == watcherID
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, lease := range leases {
+			if err := b.leases.Delete([]byte(lease.LeaseID)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+Failed returns the jobs in the dead-letter queue.
+*/
+func (q *Queue) Failed() ([]*model.Job, error) {
+	var jobs []*model.Job
+
+	err := q.update(func(b *buckets) error {
+		var err error
+		jobs, err = allJobs(b.dead)
+		return err
+	})
+
+	return jobs, err
+}
+
+/*
+Requeue moves the job for the watcher with the given ID from the dead-letter queue back to the queue, the attempts
+are reset.
+*/
+func (q *Queue) Requeue(watcherID int) error {
+	return q.updateAndWake(func(b *buckets) error {
+		job, err := removeDead(b, watcherID)
+		if err != nil {
+			return err
+		}
+
+		job.Attempts = 0
+		job.FailedAt = time.Time{}
+
+		return push(b.jobs, job)
+	})
+}
+
+/*
+Discard removes the job for the watcher with the given ID from the dead-letter queue.
+*/
+func (q *Queue) Discard(watcherID int) error {
+	return q.update(func(b *buckets) error {
+		_, err := removeDead(b, watcherID)
+		return err
+	})
+}
+
+/*
+updateAndWake runs update and wakes up the callers of NextWait when it succeeded.
+*/
+func (q *Queue) updateAndWake(fn func(b *buckets) error) error {
+	if err := q.update(fn); err != nil {
+		return err
 	}
 
+	q.readyMu.Lock()
+	close(q.ready)
+	q.ready = make(chan struct{})
+	q.readyMu.Unlock()
+
 	return nil
 }
+
+/*
+readyChannel returns the channel that is closed when jobs become available.
+*/
+func (q *Queue) readyChannel() chan struct{} {
+	q.readyMu.Lock()
+	defer q.readyMu.Unlock()
+
+	return q.ready
+}
+
+/*
+update runs the function in a read-write transaction with the buckets of the queue while holding the queue lock.
+*/
+func (q *Queue) update(fn func(b *buckets) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return fn(&buckets{
+			jobs:   tx.Bucket(bucketNames.jobs).Bucket([]byte(q.name)),
+			leases: tx.Bucket(bucketNames.leases).Bucket([]byte(q.name)),
+			dead:   tx.Bucket(bucketNames.dead).Bucket([]byte(q.name)),
+		})
+	})
+}
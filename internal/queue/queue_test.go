@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/testutil"
+	"github.com/spf13/viper"
+)
+
+/*
+openTestQueue opens a queue database in a temporary directory with a queue with the given name, the returned function
+closes and removes it.
+*/
+func openTestQueue(t *testing.T, name string) (*Queue, func()) {
+	t.Helper()
+
+	dir, removeDir := testutil.TempDir(t)
+
+	viper.Set("queue.lease_timeout", time.Minute)
+	viper.Set("queue.max_attempts", 1)
+
+	if err := Open(filepath.Join(dir, "queue.db")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Create(name); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Find(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q, func() {
+		if err := Close(); err != nil {
+			t.Error(err)
+		}
+		removeDir()
+	}
+}
+
+func TestConcurrentAddAndNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		producers int
+		consumers int
+		watchers  int
+		// duplicates makes every producer add every watcher instead of its own share of them.
+		duplicates bool
+	}{
+		{name: "one producer and one consumer", producers: 1, consumers: 1, watchers: 50},
+		{name: "more producers than consumers", producers: 8, consumers: 2, watchers: 200},
+		{name: "more consumers than producers", producers: 2, consumers: 8, watchers: 200},
+		{name: "producers add the same watchers", producers: 6, consumers: 6, watchers: 100, duplicates: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, closeQueue := openTestQueue(t, "queue_test")
+			defer closeQueue()
+
+			var producers sync.WaitGroup
+			done := make(chan struct{})
+
+			for p := 0; p < tt.producers; p++ {
+				producers.Add(1)
+				go func(p int) {
+					defer producers.Done()
+
+					for id := 1; id <= tt.watchers; id++ {
+						if !tt.duplicates && id%tt.producers != p {
+							continue
+						}
+
+						if err := q.Add(&model.Watcher{ID: id}); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(p)
+			}
+
+			go func() {
+				producers.Wait()
+				close(done)
+			}()
+
+			var mu sync.Mutex
+			leased := map[int]int{}
+
+			var consumers sync.WaitGroup
+			for c := 0; c < tt.consumers; c++ {
+				consumers.Add(1)
+				go func() {
+					defer consumers.Done()
+
+					for {
+						finished := false
+						select {
+						case <-done:
+							finished = true
+						default:
+						}
+
+						lease, err := q.Next()
+						if err != nil {
+							t.Error(err)
+							return
+						}
+
+						if lease == nil {
+							if finished {
+								return
+							}
+							continue
+						}
+
+						mu.Lock()
+						leased[lease.ID]++
+						mu.Unlock()
+					}
+				}()
+			}
+
+			consumers.Wait()
+
+			if len(leased) != tt.watchers {
+				t.Errorf("expected %d leased watchers, got %d", tt.watchers, len(leased))
+			}
+
+			for id, count := range leased {
+				if count != 1 {
+					t.Errorf("expected watcher %d to be leased once, it was leased %d times", id, count)
+				}
+			}
+
+			jobs, err := q.Jobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(jobs) != 0 {
+				t.Errorf("expected an empty queue, got %d jobs", len(jobs))
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare brings the queue in the state before the watcher with ID 1 is added.
+		prepare func(t *testing.T, q *Queue)
+		want    int
+	}{
+		{
+			name:    "empty queue",
+			prepare: func(t *testing.T, q *Queue) {},
+			want:    1,
+		},
+		{
+			name: "watcher already queued",
+			prepare: func(t *testing.T, q *Queue) {
+				if err := q.Add(&model.Watcher{ID: 1}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: 1,
+		},
+		{
+			name: "watcher leased",
+			prepare: func(t *testing.T, q *Queue) {
+				if err := q.Add(&model.Watcher{ID: 1}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := q.Next(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: 0,
+		},
+		{
+			name: "watcher acknowledged",
+			prepare: func(t *testing.T, q *Queue) {
+				if err := q.Add(&model.Watcher{ID: 1}); err != nil {
+					t.Fatal(err)
+				}
+				lease, err := q.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := q.Ack(lease.LeaseID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: 1,
+		},
+		{
+			name: "watcher in the dead-letter queue",
+			prepare: func(t *testing.T, q *Queue) {
+				if err := q.Add(&model.Watcher{ID: 1}); err != nil {
+					t.Fatal(err)
+				}
+				lease, err := q.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := q.Nack(lease.LeaseID, "page not found"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, closeQueue := openTestQueue(t, "queue_test")
+			defer closeQueue()
+
+			tt.prepare(t, q)
+
+			if err := q.Add(&model.Watcher{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			jobs, err := q.Jobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(jobs) != tt.want {
+				t.Errorf("expected %d jobs, got %d", tt.want, len(jobs))
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// registry contains the opened queue database and the queues that are created in it.
+var registry = struct {
+	sync.RWMutex
+	db     *bolt.DB
+	queues map[string]*Queue
+}{queues: map[string]*Queue{}}
+
+/*
+Open opens the BoltDB database that stores the queues, it needs to be called before any queue can be used.
+The database can not be the same file as a bolt watcher database, the watcher store keeps its database open and a
+BoltDB file can only be opened once at a time.
+*/
+func Open(path string) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.db != nil {
+		return fmt.Errorf("queue database is already opened")
+	}
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketNames.jobs, bucketNames.leases, bucketNames.dead} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	registry.db = db
+	return nil
+}
+
+/*
+Close closes the queue database and forgets all the created queues.
+*/
+func Close() error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.db == nil {
+		return nil
+	}
+
+	err := registry.db.Close()
+	registry.db = nil
+	registry.queues = map[string]*Queue{}
+
+	return err
+}
+
+/*
+Create creates a new queue with the given name if it does not exist, jobs that were persisted in an earlier run are
+kept.
+*/
+func Create(domain ...string) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.db == nil {
+		return fmt.Errorf("queue database is not opened")
+	}
+
+	for _, v := range domain {
+		if _, ok := registry.queues[v]; ok {
+			return fmt.Errorf("queue with name '%s' already exists", v)
+		}
+
+		err := registry.db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{bucketNames.jobs, bucketNames.leases, bucketNames.dead} {
+				if _, err := tx.Bucket(name).CreateBucketIfNotExists([]byte(v)); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		registry.queues[v] = newQueue(v, registry.db)
+	}
+
+	return nil
+}
+
+/*
+Find returns the queue with the given name.
+*/
+func Find(name string) (*Queue, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if registry.db == nil {
+		return nil, fmt.Errorf("queue database is not opened")
+	}
+
+	if q, ok := registry.queues[name]; ok {
+		return q, nil
+	}
+
+	return nil, fmt.Errorf("could not find queue '%s'", name)
+}
+
+/*
+ListQueues returns a sorted list of the names of the queues that are currently registered.
+*/
+func ListQueues() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for k := range registry.queues {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+GetNameForDomain returns a queue equivalent name for the given domain.
+It prepends "queue_" to the given domain and replaces "." with "_".
+*/
+func GetNameForDomain(domain string) string {
+	return "queue_" + strings.ReplaceAll(domain, ".", "_")
+}
+
+/*
+Get returns a list of items in the queue with the given name.
+*/
+func Get(queueName string) ([]*model.Job, error) {
+	q, err := Find(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Jobs()
+}
+
+/*
+Add adds the given watcher to the queue with the given name.
+*/
+func Add(queueName string, watcher *model.Watcher) error {
+	q, err := Find(queueName)
+	if err != nil {
+		return err
+	}
+
+	return q.Add(watcher)
+}
+
+/*
+Next hands out the first job from the queue with the given name as a lease, returns nil if the queue is empty.
+*/
+func Next(name string) (*model.Lease, error) {
+	q, err := Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Next()
+}
+
+/*
+NextWait hands out the first job from the queue with the given name as a lease, it waits for a job until the context is
+done when the queue is empty.
+*/
+func NextWait(ctx context.Context, name string) (*model.Lease, error) {
+	q, err := Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.NextWait(ctx)
+}
+
+/*
+Ack acknowledges the lease in the queue with the given name.
+*/
+func Ack(name, leaseID string) error {
+	q, err := Find(name)
+	if err != nil {
+		return err
+	}
+
+	return q.Ack(leaseID)
+}
+
+/*
+Nack reports the lease in the queue with the given name as failed.
+*/
+func Nack(name, leaseID, reason string) error {
+	q, err := Find(name)
+	if err != nil {
+		return err
+	}
+
+	return q.Nack(leaseID, reason)
+}
+
+/*
+AckWatcher acknowledges all the leases for the watcher with the given ID in all the queues, this is used when a price
+update is received from a worker that does not acknowledge its jobs.
+*/
+func AckWatcher(watcherID int) error {
+	for _, name := range ListQueues() {
+		q, err := Find(name)
+		if err != nil {
+			return err
+		}
+
+		if err := q.AckWatcher(watcherID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Failed returns the jobs in the dead-letter queue of the queue with the given name.
+*/
+func Failed(name string) ([]*model.Job, error) {
+	q, err := Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Failed()
+}
+
+/*
+Requeue moves the job for the watcher with the given ID from the dead-letter queue back to the queue with the given
+name.
+*/
+func Requeue(name string, watcherID int) error {
+	q, err := Find(name)
+	if err != nil {
+		return err
+	}
+
+	return q.Requeue(watcherID)
+}
+
+/*
+Discard removes the job for the watcher with the given ID from the dead-letter queue of the queue with the given name.
+*/
+func Discard(name string, watcherID int) error {
+	q, err := Find(name)
+	if err != nil {
+		return err
+	}
+
+	return q.Discard(watcherID)
+}
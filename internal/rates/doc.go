@@ -0,0 +1,4 @@
+/*
+Package rates contains the exchange rates that are used to convert prices to other currencies.
+*/
+package rates
@@ -0,0 +1,116 @@
+package rates
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/money"
+)
+
+// dateFormat is the format of the dates in the feed.
+const dateFormat = "2006-01-02"
+
+// Day contains the exchange rates of one day, a rate is the amount of the currency for one unit of the base currency.
+type Day struct {
+	Date  time.Time
+	Rates map[string]*big.Rat
+}
+
+// envelope is the ECB euro foreign exchange reference rates format:
+//
+//	<gesmes:Envelope><Cube><Cube time="2020-03-13"><Cube currency="USD" rate="1.1104"/>...</Cube></Cube></gesmes:Envelope>
+type envelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+/*
+Fetch reads the exchange rates from an ECB style XML feed, the source is either an http(s) URL or the path of a local
+file. The base currency of the feed is added to every day with a rate of 1.
+*/
+func Fetch(source, base string, timeout time.Duration) ([]Day, error) {
+	var reader io.Reader
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: timeout}
+
+		response, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching exchange rates from '%s' failed, status code %d", source, response.StatusCode)
+		}
+
+		reader = response.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	return parse(reader, base)
+}
+
+/*
+parse parses the ECB style XML feed.
+*/
+func parse(reader io.Reader, base string) ([]Day, error) {
+	base, err := money.NormalizeCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := envelope{}
+	if err := xml.NewDecoder(reader).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("could not read the exchange rates: %s", err.Error())
+	}
+
+	var days []Day
+	for _, feedDay := range feed.Days {
+		date, err := time.Parse(dateFormat, feedDay.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchange rate date '%s'", feedDay.Time)
+		}
+
+		day := Day{Date: date, Rates: map[string]*big.Rat{base: big.NewRat(1, 1)}}
+		for _, rate := range feedDay.Rates {
+			currency, err := money.NormalizeCurrency(rate.Currency)
+			if err != nil {
+				return nil, err
+			}
+
+			value, ok := new(big.Rat).SetString(rate.Rate)
+			if !ok || value.Sign() <= 0 {
+				return nil, fmt.Errorf("invalid exchange rate '%s' for %s on %s", rate.Rate, currency, feedDay.Time)
+			}
+
+			day.Rates[currency] = value
+		}
+
+		days = append(days, day)
+	}
+
+	if len(days) == 0 {
+		return nil, fmt.Errorf("no exchange rates found")
+	}
+
+	return days, nil
+}
@@ -0,0 +1,142 @@
+package rates
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/spf13/viper"
+)
+
+// Storage stores the exchange rates of every day.
+type Storage interface {
+	StoreRates(days []Day) error
+	LoadRates() ([]Day, error)
+}
+
+/*
+Update fetches the exchange rates from the configured source and stores them, returns the amount of days that were
+stored.
+*/
+func Update(storage Storage) (int, error) {
+	source := viper.GetString("rates.source")
+	if source == "" {
+		return 0, fmt.Errorf("no exchange rate source configured")
+	}
+
+	days, err := Fetch(source, viper.GetString("rates.base"), viper.GetDuration("rates.timeout"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(days), storage.StoreRates(days)
+}
+
+// Table contains all the stored exchange rates ordered by day.
+type Table struct {
+	days []Day
+}
+
+/*
+Load reads all the stored exchange rates.
+*/
+func Load(storage Storage) (*Table, error) {
+	days, err := storage.LoadRates()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &Table{days: days}
+
+	// Sort anyway so the table does not depend on the order of the storage.
+	sort.Slice(table.days, func(i, j int) bool {
+		return table.days[i].Date.Before(table.days[j].Date)
+	})
+
+	return table, nil
+}
+
+/*
+Convert converts the amount to the given currency with the rates that were valid at the given time: the rates of the
+last day on or before that time that has both currencies. The rates of the first day after that time are used for
+older amounts.
+*/
+func (t *Table) Convert(amount money.Money, currency string, at time.Time) (money.Money, error) {
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	// The index of the first day after the time, the days before it are tried from new to old.
+	after := sort.Search(len(t.days), func(i int) bool {
+		return t.days[i].Date.After(at)
+	})
+
+	candidates := make([]Day, 0, len(t.days))
+	for i := after - 1; i >= 0; i-- {
+		candidates = append(candidates, t.days[i])
+	}
+	candidates = append(candidates, t.days[after:]...)
+
+	for _, day := range candidates {
+		from, okFrom := day.Rates[amount.Currency]
+		to, okTo := day.Rates[currency]
+		if !okFrom || !okTo {
+			continue
+		}
+
+		return amount.Convert(currency, new(big.Rat).Quo(to, from)), nil
+	}
+
+	return money.Money{}, fmt.Errorf("no exchange rate from %s to %s", amount.Currency, currency)
+}
+
+/*
+ConvertWatcher converts the last and lowest price, the price history and the prices of the alerts of the watcher to the
+given currency.
+*/
+func (t *Table) ConvertWatcher(watcher *model.Watcher, currency string) error {
+	for _, price := range []*model.Price{watcher.LastPrice, watcher.LowestPrice} {
+		if price == nil {
+			continue
+		}
+
+		if err := t.convertPrice(price, currency); err != nil {
+			return err
+		}
+	}
+
+	for i := range watcher.PriceHistory {
+		if err := t.convertPrice(&watcher.PriceHistory[i], currency); err != nil {
+			return err
+		}
+	}
+
+	for i := range watcher.Alerts {
+		if err := t.convertPrice(&watcher.Alerts[i].Price, currency); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+convertPrice converts the value of the price to the given currency with the rates valid at its timestamp.
+*/
+func (t *Table) convertPrice(price *model.Price, currency string) error {
+	converted, err := t.Convert(price.Value, currency, price.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	price.Value = converted
+	return nil
+}
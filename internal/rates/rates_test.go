@@ -0,0 +1,168 @@
+package rates
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/pricewatcher/internal/testutil"
+	"github.com/spf13/viper"
+)
+
+// feed is an ECB style feed with the newest day first, like the ECB publishes it. The last day has no GBP rate.
+const feed = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2020-03-13">
+			<Cube currency="USD" rate="1.2"/>
+		</Cube>
+		<Cube time="2020-03-12">
+			<Cube currency="USD" rate="1.1"/>
+			<Cube currency="GBP" rate="0.9"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+// memoryStorage keeps the stored exchange rates in memory.
+type memoryStorage struct {
+	days []Day
+}
+
+func (s *memoryStorage) StoreRates(days []Day) error {
+	s.days = days
+	return nil
+}
+
+func (s *memoryStorage) LoadRates() ([]Day, error) {
+	return s.days, nil
+}
+
+/*
+serveFeed serves the rates feed stand-in with the given status code and body.
+*/
+func serveFeed(status int, body string) *httptest.Server {
+	return testutil.ServePages(map[string]testutil.Page{
+		"/": {Status: status, ContentType: "text/xml", Body: body},
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		noSource bool
+		want     int
+		wantErr  bool
+	}{
+		{name: "feed", status: http.StatusOK, body: feed, want: 2},
+		{name: "server error", status: http.StatusInternalServerError, body: "unavailable", wantErr: true},
+		{name: "not a feed", status: http.StatusOK, body: "<html>", wantErr: true},
+		{name: "feed without days", status: http.StatusOK, body: "<Envelope><Cube></Cube></Envelope>", wantErr: true},
+		{
+			name:    "invalid rate",
+			status:  http.StatusOK,
+			body:    `<Envelope><Cube><Cube time="2020-03-13"><Cube currency="USD" rate="-1"/></Cube></Cube></Envelope>`,
+			wantErr: true,
+		},
+		{name: "no source configured", noSource: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serveFeed(tt.status, tt.body)
+			defer server.Close()
+
+			viper.Set("rates.source", server.URL)
+			if tt.noSource {
+				viper.Set("rates.source", "")
+			}
+			viper.Set("rates.base", "EUR")
+			viper.Set("rates.timeout", 5*time.Second)
+
+			storage := &memoryStorage{}
+			stored, err := Update(storage)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored != tt.want || len(storage.days) != tt.want {
+				t.Errorf("expected %d stored days, got %d and %d", tt.want, stored, len(storage.days))
+			}
+
+			for _, day := range storage.days {
+				if rate, ok := day.Rates["EUR"]; !ok || rate.RatString() != "1" {
+					t.Errorf("expected a base rate of 1 on %s, got %v", day.Date.Format(dateFormat), rate)
+				}
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	server := serveFeed(http.StatusOK, feed)
+	defer server.Close()
+
+	days, err := Fetch(server.URL, "EUR", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := Load(&memoryStorage{days: days})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenEuro := money.New(1000, "EUR")
+
+	tests := []struct {
+		name     string
+		amount   money.Money
+		currency string
+		at       string
+		want     string
+		wantErr  bool
+	}{
+		{name: "rate of the day", amount: tenEuro, currency: "USD", at: "2020-03-13T12:00:00Z", want: "12.00 USD"},
+		{name: "rate of the day before", amount: tenEuro, currency: "USD", at: "2020-03-12T23:00:00Z", want: "11.00 USD"},
+		{name: "older than the feed", amount: tenEuro, currency: "USD", at: "2020-03-01T00:00:00Z", want: "11.00 USD"},
+		{name: "newer than the feed", amount: tenEuro, currency: "USD", at: "2020-04-01T00:00:00Z", want: "12.00 USD"},
+		{name: "currency missing on the day", amount: tenEuro, currency: "GBP", at: "2020-03-13T12:00:00Z", want: "9.00 GBP"},
+		{name: "between two rates", amount: money.New(1100, "USD"), currency: "GBP", at: "2020-03-12T12:00:00Z", want: "9.00 GBP"},
+		{name: "same currency", amount: money.New(1234, "USD"), currency: "usd", at: "2020-03-13T12:00:00Z", want: "12.34 USD"},
+		{name: "unknown currency", amount: tenEuro, currency: "CHF", at: "2020-03-13T12:00:00Z", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := table.Convert(tt.amount, tt.currency, at)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.String() != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/*
+Backup writes a consistent snapshot of the database to the writer in a read transaction, so the watchers can be
+changed while the backup is written.
+*/
+func (s *Bolt) Backup(w io.Writer) (int64, error) {
+	var n int64
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+
+	return n, err
+}
+
+/*
+Backup writes a consistent snapshot of the database to the writer, the snapshot is made in a temporary file with
+VACUUM INTO first.
+*/
+func (s *SQLite) Backup(w io.Writer) (int64, error) {
+	dir, err := ioutil.TempDir("", "pricewatcher-backup")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "backup.sqlite")
+	if _, err := s.db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
+
+/*
+Backup can not back up the in-memory store, there is no database file.
+*/
+func (s *Memory) Backup(w io.Writer) (int64, error) {
+	return 0, fmt.Errorf("the in-memory store can not be backed up")
+}
+
+/*
+Check checks if the file is a readable database of the driver without changing it.
+*/
+func Check(driver, path string, timeout time.Duration) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	switch driver {
+	case DriverBolt:
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout, ReadOnly: true})
+		if err != nil {
+			return fmt.Errorf("not a bolt database: %s", err.Error())
+		}
+		defer db.Close()
+
+		return db.View(func(tx *bolt.Tx) error {
+			if tx.Bucket(WatchersBucket) == nil {
+				return fmt.Errorf("not a pricewatcher database, it has no watchers")
+			}
+
+			// Read all the errors, the check stops when they are read.
+			var damaged error
+			for err := range tx.Check() {
+				if damaged == nil {
+					damaged = fmt.Errorf("the database is damaged: %s", err.Error())
+				}
+			}
+
+			return damaged
+		})
+	case DriverSQLite:
+		// Opened read-only without creating the schema, so the file is not changed and a SQLite database of another
+		// application is not turned into an empty pricewatcher database.
+		db, err := sql.Open(
+			"sqlite3",
+			fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", path, timeout.Milliseconds()),
+		)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		var result string
+		if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+			return fmt.Errorf("not a SQLite database: %s", err.Error())
+		}
+
+		if result != "ok" {
+			return fmt.Errorf("the database is damaged: %s", result)
+		}
+
+		var tables int
+		if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'watchers'").Scan(&tables); err != nil {
+			return err
+		}
+
+		if tables == 0 {
+			return fmt.Errorf("not a pricewatcher database, it has no watchers")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown database driver '%s', use '%s' or '%s'", driver, DriverBolt, DriverSQLite)
+	}
+}
+
+/*
+Replace replaces the database at the path with the database file at the replacement path, the replaced database is
+kept next to it and its path is returned. Bolt databases can not be replaced while another process has them open.
+*/
+func Replace(driver, path, replacement string, timeout time.Duration) (string, error) {
+	previous := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102150405"))
+
+	switch driver {
+	case DriverBolt:
+		// Hold the lock while the files are swapped, so no other process uses the replaced database.
+		db, err := OpenDB(path, timeout)
+		if err != nil {
+			return "", err
+		}
+		defer db.Close()
+	case DriverSQLite:
+		// Move the write-ahead log into the database, so the database file is complete.
+		s, err := OpenSQLite(path, timeout)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown database driver '%s', use '%s' or '%s'", driver, DriverBolt, DriverSQLite)
+	}
+
+	if err := os.Rename(path, previous); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(replacement, path); err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+/*
+Compact rewrites the database to reclaim the space of removed watchers and prices, returns the size of the database
+file before and after. Bolt databases can not be compacted while another process has them open.
+*/
+func Compact(driver, path string, timeout time.Duration) (int64, int64, error) {
+	before, err := fileSize(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch driver {
+	case DriverBolt:
+		err = compactBolt(path, timeout)
+	case DriverSQLite:
+		err = compactSQLite(path, timeout)
+	default:
+		err = fmt.Errorf("unknown database driver '%s', use '%s' or '%s'", driver, DriverBolt, DriverSQLite)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	after, err := fileSize(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return before, after, nil
+}
+
+/*
+compactBolt copies all the buckets to a new database file and replaces the database with it, bolt never shrinks its
+file by itself.
+*/
+func compactBolt(path string, timeout time.Duration) error {
+	src, err := OpenDB(path, timeout)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	compacted := path + ".compact"
+	if err := os.Remove(compacted); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dst, err := bolt.Open(compacted, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = src.View(func(stx *bolt.Tx) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				nb, err := dtx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+
+				return copyBucket(b, nb)
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(compacted)
+		return err
+	}
+
+	// The lock on the database is held until the compacted file replaced it.
+	return os.Rename(compacted, path)
+}
+
+/*
+copyBucket copies the keys, the nested buckets and the sequence of a bucket.
+*/
+func copyBucket(from, to *bolt.Bucket) error {
+	if err := to.SetSequence(from.Sequence()); err != nil {
+		return err
+	}
+
+	return from.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return to.Put(k, v)
+		}
+
+		nested, err := to.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(from.Bucket(k), nested)
+	})
+}
+
+/*
+compactSQLite rebuilds the database with VACUUM and empties the write-ahead log.
+*/
+func compactSQLite(path string, timeout time.Duration) error {
+	s, err := OpenSQLite(path, timeout)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+/*
+fileSize returns the size of the database file including the SQLite write-ahead log.
+*/
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	}
+
+	return size, nil
+}
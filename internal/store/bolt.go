@@ -0,0 +1,637 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/rates"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// WatchersBucket contains the watchers without their price history, keyed by ID.
+	WatchersBucket = []byte("watchers")
+	// PricesBucket contains a nested bucket with the price history for every watcher keyed by watcher ID, the prices
+	// are keyed by PriceKey so new prices are appended and a time range can be read with a cursor.
+	PricesBucket = []byte("prices")
+	// RatesBucket contains a nested bucket with the exchange rates for every day.
+	RatesBucket = []byte("rates")
+	// CollectionsBucket contains the collections keyed by name.
+	CollectionsBucket = []byte("collections")
+	// UsersBucket contains the users keyed by name.
+	UsersBucket = []byte("users")
+)
+
+// rateDateFormat is the format of the day buckets in the rates bucket.
+const rateDateFormat = "2006-01-02"
+
+// Bolt is a store in a BoltDB database that stays open until it is closed, only one process can open the database.
+type Bolt struct {
+	db *bolt.DB
+}
+
+/*
+OpenBolt opens the BoltDB database at the given path, it waits up to the timeout when another process has the database
+open.
+*/
+func OpenBolt(path string, timeout time.Duration) (*Bolt, error) {
+	db, err := OpenDB(path, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{WatchersBucket, PricesBucket, RatesBucket, CollectionsBucket, UsersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+/*
+OpenDB opens the BoltDB database file at the given path, it waits up to the timeout when another process has the
+database open and fails with ErrInUse after that.
+*/
+func OpenDB(path string, timeout time.Duration) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err == bolt.ErrTimeout {
+		return nil, ErrInUse
+	}
+
+	return db, err
+}
+
+/*
+Add stores a new watcher and sets its ID, bolt has a single writer so the URL check can not race with another write.
+*/
+func (s *Bolt) Add(watcher *model.Watcher) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+
+		if err := checkBoltURL(b, watcher.URL, 0); err != nil {
+			return err
+		}
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		watcher.ID = int(id)
+
+		return putWatcher(b, watcher)
+	})
+}
+
+/*
+Get returns the watcher with the given ID.
+*/
+func (s *Bolt) Get(id int) (*model.Watcher, error) {
+	watcher := &model.Watcher{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(WatchersBucket).Get(itob(id))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(v, watcher)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+/*
+List returns all the watchers ordered by ID.
+*/
+func (s *Bolt) List() ([]model.Watcher, error) {
+	watchers := []model.Watcher{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(WatchersBucket).ForEach(func(_, v []byte) error {
+			watcher := model.Watcher{}
+			if err := json.Unmarshal(v, &watcher); err != nil {
+				return err
+			}
+
+			watchers = append(watchers, watcher)
+			return nil
+		})
+	})
+
+	return watchers, err
+}
+
+/*
+Remove removes the watcher with the given ID and its price history.
+*/
+func (s *Bolt) Remove(id int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+		if b.Get(itob(id)) == nil {
+			return ErrNotFound
+		}
+
+		prices := tx.Bucket(PricesBucket)
+		if prices.Bucket(itob(id)) != nil {
+			if err := prices.DeleteBucket(itob(id)); err != nil {
+				return err
+			}
+		}
+
+		return b.Delete(itob(id))
+	})
+}
+
+/*
+RemoveAll removes all the watchers and their price histories, returns the IDs of the removed watchers.
+*/
+func (s *Bolt) RemoveAll() ([]int, error) {
+	var ids []int
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+
+		// Keys can not be deleted while iterating, so collect them first.
+		err := b.ForEach(func(k, _ []byte) error {
+			ids = append(ids, btoi(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := b.Delete(itob(id)); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.DeleteBucket(PricesBucket); err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket(PricesBucket)
+		return err
+	})
+
+	return ids, err
+}
+
+/*
+Update changes the watcher in a single transaction, nothing changes when update fails.
+*/
+func (s *Bolt) Update(id int, update func(watcher *model.Watcher) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+
+		v := b.Get(itob(id))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		watcher := &model.Watcher{}
+		if err := json.Unmarshal(v, watcher); err != nil {
+			return err
+		}
+
+		url := watcher.URL
+		if err := update(watcher); err != nil {
+			return err
+		}
+		watcher.ID = id
+
+		if watcher.URL != url {
+			if err := checkBoltURL(b, watcher.URL, id); err != nil {
+				return err
+			}
+		}
+
+		return putWatcher(b, watcher)
+	})
+}
+
+/*
+AppendPrice adds the price to the history of the watcher in the same transaction as the changes update makes.
+*/
+func (s *Bolt) AppendPrice(id int, price model.Price, update func(watcher *model.Watcher) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+
+		v := b.Get(itob(id))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		watcher := &model.Watcher{}
+		if err := json.Unmarshal(v, watcher); err != nil {
+			return err
+		}
+
+		if err := update(watcher); err != nil {
+			return err
+		}
+
+		history, err := tx.Bucket(PricesBucket).CreateBucketIfNotExists(itob(id))
+		if err != nil {
+			return err
+		}
+
+		// The sequence keeps prices with the same timestamp apart.
+		sequence, err := history.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		p, err := json.Marshal(price)
+		if err != nil {
+			return err
+		}
+
+		if err := history.Put(PriceKey(price.Timestamp, sequence), p); err != nil {
+			return err
+		}
+
+		return putWatcher(b, watcher)
+	})
+}
+
+/*
+History returns the prices of the watcher in the given time range ordered by timestamp.
+*/
+func (s *Bolt) History(id int, from, to time.Time) ([]model.Price, error) {
+	prices := []model.Price{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(PricesBucket).Bucket(itob(id))
+		if history == nil {
+			return nil
+		}
+
+		c := history.Cursor()
+
+		k, v := c.First()
+		if !from.IsZero() {
+			k, v = c.Seek(PriceKey(from, 0))
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			if !to.IsZero() && keyTime(k).After(to) {
+				break
+			}
+
+			price := model.Price{}
+			if err := json.Unmarshal(v, &price); err != nil {
+				return err
+			}
+
+			prices = append(prices, price)
+		}
+
+		return nil
+	})
+
+	return prices, err
+}
+
+/*
+Import stores the watcher with its ID and its price history, later watchers get an ID after the highest imported ID.
+*/
+func (s *Bolt) Import(watcher *model.Watcher, history []model.Price) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(WatchersBucket)
+		if b.Get(itob(watcher.ID)) != nil {
+			return fmt.Errorf("a watcher with ID %d already exists", watcher.ID)
+		}
+
+		if uint64(watcher.ID) > b.Sequence() {
+			if err := b.SetSequence(uint64(watcher.ID)); err != nil {
+				return err
+			}
+		}
+
+		prices, err := tx.Bucket(PricesBucket).CreateBucketIfNotExists(itob(watcher.ID))
+		if err != nil {
+			return err
+		}
+
+		for _, price := range history {
+			sequence, err := prices.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			p, err := json.Marshal(price)
+			if err != nil {
+				return err
+			}
+
+			if err := prices.Put(PriceKey(price.Timestamp, sequence), p); err != nil {
+				return err
+			}
+		}
+
+		return putWatcher(b, watcher)
+	})
+}
+
+/*
+StoreRates stores the exchange rates of the given days, the rates of a day that was already stored are replaced.
+*/
+func (s *Bolt) StoreRates(days []rates.Day) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(RatesBucket)
+
+		for _, day := range days {
+			key := []byte(day.Date.Format(rateDateFormat))
+			if b.Bucket(key) != nil {
+				if err := b.DeleteBucket(key); err != nil {
+					return err
+				}
+			}
+
+			dayBucket, err := b.CreateBucket(key)
+			if err != nil {
+				return err
+			}
+
+			for currency, rate := range day.Rates {
+				if err := dayBucket.Put([]byte(currency), []byte(rate.RatString())); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+LoadRates returns the stored exchange rates of all the days ordered by day.
+*/
+func (s *Bolt) LoadRates() ([]rates.Day, error) {
+	var days []rates.Day
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(RatesBucket)
+
+		return b.ForEach(func(k, _ []byte) error {
+			date, err := time.Parse(rateDateFormat, string(k))
+			if err != nil {
+				return err
+			}
+
+			day := rates.Day{Date: date, Rates: map[string]*big.Rat{}}
+			err = b.Bucket(k).ForEach(func(currency, rate []byte) error {
+				value, ok := new(big.Rat).SetString(string(rate))
+				if !ok {
+					return fmt.Errorf("invalid stored exchange rate '%s' for %s on %s", rate, currency, k)
+				}
+
+				day.Rates[string(currency)] = value
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			days = append(days, day)
+			return nil
+		})
+	})
+
+	return days, err
+}
+
+/*
+Collections returns all the collections ordered by name.
+*/
+func (s *Bolt) Collections() ([]model.Collection, error) {
+	collections := []model.Collection{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(CollectionsBucket).ForEach(func(_, v []byte) error {
+			collection := model.Collection{}
+			if err := json.Unmarshal(v, &collection); err != nil {
+				return err
+			}
+
+			collections = append(collections, collection)
+			return nil
+		})
+	})
+
+	return collections, err
+}
+
+/*
+Collection returns the collection with the given name.
+*/
+func (s *Bolt) Collection(name string) (*model.Collection, error) {
+	collection := &model.Collection{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(CollectionsBucket).Get([]byte(name))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(v, collection)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+/*
+SaveCollection stores the collection, a collection with the same name is replaced.
+*/
+func (s *Bolt) SaveCollection(collection *model.Collection) error {
+	v, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(CollectionsBucket).Put([]byte(collection.Name), v)
+	})
+}
+
+/*
+RemoveCollection removes the collection with the given name.
+*/
+func (s *Bolt) RemoveCollection(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(CollectionsBucket)
+		if b.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+
+		return b.Delete([]byte(name))
+	})
+}
+
+/*
+Users returns all the users ordered by name.
+*/
+func (s *Bolt) Users() ([]model.User, error) {
+	users := []model.User{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(UsersBucket).ForEach(func(_, v []byte) error {
+			user := model.User{}
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+
+			users = append(users, user)
+			return nil
+		})
+	})
+
+	return users, err
+}
+
+/*
+User returns the user with the given name.
+*/
+func (s *Bolt) User(name string) (*model.User, error) {
+	user := &model.User{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(UsersBucket).Get([]byte(name))
+		if v == nil {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(v, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+/*
+SaveUser stores the user, a user with the same name is replaced.
+*/
+func (s *Bolt) SaveUser(user *model.User) error {
+	v, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(UsersBucket).Put([]byte(user.Name), v)
+	})
+}
+
+/*
+RemoveUser removes the user with the given name.
+*/
+func (s *Bolt) RemoveUser(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(UsersBucket)
+		if b.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+
+		return b.Delete([]byte(name))
+	})
+}
+
+/*
+Close closes the database.
+*/
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+/*
+PriceKey returns the key of a price in the history of a watcher: the timestamp as 8 bytes that sort in time order,
+including the times before 1970, followed by the sequence that keeps prices with the same timestamp apart.
+*/
+func PriceKey(timestamp time.Time, sequence uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(timestamp.UnixNano())^(1<<63))
+	binary.BigEndian.PutUint64(key[8:], sequence)
+	return key
+}
+
+/*
+keyTime returns the timestamp of a price key.
+*/
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])^(1<<63)))
+}
+
+/*
+checkBoltURL returns ErrDuplicateURL when a watcher other than the watcher with the given ID has the URL.
+*/
+func checkBoltURL(b *bolt.Bucket, url string, id int) error {
+	return b.ForEach(func(_, v []byte) error {
+		stored := struct {
+			ID  int
+			URL string
+		}{}
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+
+		if stored.URL == url && stored.ID != id {
+			return ErrDuplicateURL
+		}
+
+		return nil
+	})
+}
+
+/*
+putWatcher stores the watcher without its price history.
+*/
+func putWatcher(b *bolt.Bucket, watcher *model.Watcher) error {
+	stored := *watcher
+	stored.PriceHistory = nil
+
+	v, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(itob(watcher.ID), v)
+}
+
+/*
+btoi returns an int for the given 8-byte big endian representation.
+*/
+func btoi(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}
+
+/*
+itob returns an 8-byte big endian representation of v.
+*/
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
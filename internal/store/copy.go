@@ -0,0 +1,66 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Copy copies the watchers with their IDs and price histories, the collections, the users and the exchange rates from one
+store to another, returns the amount of copied watchers. The store that is copied to can not have any watchers.
+*/
+func Copy(from, to Store) (int, error) {
+	existing, err := to.List()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("the database to copy to already has %d watcher(s)", len(existing))
+	}
+
+	watchers, err := from.List()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range watchers {
+		history, err := from.History(watchers[i].ID, time.Time{}, time.Time{})
+		if err != nil {
+			return i, err
+		}
+
+		if err := to.Import(&watchers[i], history); err != nil {
+			return i, err
+		}
+	}
+
+	collections, err := from.Collections()
+	if err != nil {
+		return len(watchers), err
+	}
+
+	for i := range collections {
+		if err := to.SaveCollection(&collections[i]); err != nil {
+			return len(watchers), err
+		}
+	}
+
+	users, err := from.Users()
+	if err != nil {
+		return len(watchers), err
+	}
+
+	for i := range users {
+		if err := to.SaveUser(&users[i]); err != nil {
+			return len(watchers), err
+		}
+	}
+
+	days, err := from.LoadRates()
+	if err != nil {
+		return len(watchers), err
+	}
+
+	return len(watchers), to.StoreRates(days)
+}
@@ -0,0 +1,4 @@
+/*
+Package store contains the storage of the watchers and their price histories.
+*/
+package store
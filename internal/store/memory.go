@@ -0,0 +1,485 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/rates"
+)
+
+// Memory is a store that keeps everything in memory, it is meant for tests and nothing is kept after the process ends.
+type Memory struct {
+	mutex       sync.RWMutex
+	sequence    int
+	watchers    map[int]model.Watcher
+	prices      map[int][]model.Price
+	rates       map[string]rates.Day
+	collections map[string]model.Collection
+	users       map[string]model.User
+}
+
+/*
+NewMemory returns an empty in-memory store.
+*/
+func NewMemory() *Memory {
+	return &Memory{
+		watchers:    map[int]model.Watcher{},
+		prices:      map[int][]model.Price{},
+		rates:       map[string]rates.Day{},
+		collections: map[string]model.Collection{},
+		users:       map[string]model.User{},
+	}
+}
+
+/*
+Add stores a new watcher and sets its ID.
+*/
+func (s *Memory) Add(watcher *model.Watcher) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkURL(watcher.URL, 0); err != nil {
+		return err
+	}
+
+	s.sequence++
+	watcher.ID = s.sequence
+	s.put(watcher)
+
+	return nil
+}
+
+/*
+Get returns the watcher with the given ID.
+*/
+func (s *Memory) Get(id int) (*model.Watcher, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	watcher, ok := s.watchers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyWatcher(watcher), nil
+}
+
+/*
+List returns all the watchers ordered by ID.
+*/
+func (s *Memory) List() ([]model.Watcher, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	watchers := make([]model.Watcher, 0, len(s.watchers))
+	for _, watcher := range s.watchers {
+		watchers = append(watchers, *copyWatcher(watcher))
+	}
+
+	sort.Slice(watchers, func(i, j int) bool {
+		return watchers[i].ID < watchers[j].ID
+	})
+
+	return watchers, nil
+}
+
+/*
+Remove removes the watcher with the given ID and its price history.
+*/
+func (s *Memory) Remove(id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.watchers[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.watchers, id)
+	delete(s.prices, id)
+
+	return nil
+}
+
+/*
+RemoveAll removes all the watchers and their price histories, returns the IDs of the removed watchers.
+*/
+func (s *Memory) RemoveAll() ([]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]int, 0, len(s.watchers))
+	for id := range s.watchers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	s.watchers = map[int]model.Watcher{}
+	s.prices = map[int][]model.Price{}
+
+	return ids, nil
+}
+
+/*
+Update changes the watcher, nothing changes when update fails.
+*/
+func (s *Memory) Update(id int, update func(watcher *model.Watcher) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.watchers[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	watcher := copyWatcher(stored)
+	if err := update(watcher); err != nil {
+		return err
+	}
+	watcher.ID = id
+
+	if watcher.URL != stored.URL {
+		if err := s.checkURL(watcher.URL, id); err != nil {
+			return err
+		}
+	}
+
+	s.put(watcher)
+
+	return nil
+}
+
+/*
+AppendPrice adds the price to the history of the watcher together with the changes update makes, nothing changes when
+update fails.
+*/
+func (s *Memory) AppendPrice(id int, price model.Price, update func(watcher *model.Watcher) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.watchers[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	watcher := copyWatcher(stored)
+	if err := update(watcher); err != nil {
+		return err
+	}
+
+	// Insert after the prices with the same or an earlier timestamp, like the keys of the bolt store sort.
+	history := s.prices[id]
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(price.Timestamp)
+	})
+	history = append(history, model.Price{})
+	copy(history[i+1:], history[i:])
+	history[i] = price
+
+	s.prices[id] = history
+	s.put(watcher)
+
+	return nil
+}
+
+/*
+History returns the prices of the watcher in the given time range ordered by timestamp.
+*/
+func (s *Memory) History(id int, from, to time.Time) ([]model.Price, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	prices := []model.Price{}
+	for _, price := range s.prices[id] {
+		if !from.IsZero() && price.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && price.Timestamp.After(to) {
+			break
+		}
+
+		prices = append(prices, price)
+	}
+
+	return prices, nil
+}
+
+/*
+Import stores the watcher with its ID and its price history, later watchers get an ID after the highest imported ID.
+*/
+func (s *Memory) Import(watcher *model.Watcher, history []model.Price) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.watchers[watcher.ID]; ok {
+		return fmt.Errorf("a watcher with ID %d already exists", watcher.ID)
+	}
+
+	if watcher.ID > s.sequence {
+		s.sequence = watcher.ID
+	}
+
+	prices := append([]model.Price(nil), history...)
+	sort.SliceStable(prices, func(i, j int) bool {
+		return prices[i].Timestamp.Before(prices[j].Timestamp)
+	})
+
+	s.prices[watcher.ID] = prices
+	s.put(watcher)
+
+	return nil
+}
+
+/*
+StoreRates stores the exchange rates of the given days, the rates of a day that was already stored are replaced.
+*/
+func (s *Memory) StoreRates(days []rates.Day) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, day := range days {
+		s.rates[day.Date.Format(rateDateFormat)] = day
+	}
+
+	return nil
+}
+
+/*
+LoadRates returns the stored exchange rates of all the days ordered by day.
+*/
+func (s *Memory) LoadRates() ([]rates.Day, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	days := make([]rates.Day, 0, len(s.rates))
+	for _, day := range s.rates {
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+
+	return days, nil
+}
+
+/*
+Collections returns all the collections ordered by name.
+*/
+func (s *Memory) Collections() ([]model.Collection, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	collections := make([]model.Collection, 0, len(s.collections))
+	for _, collection := range s.collections {
+		collections = append(collections, *copyCollection(collection))
+	}
+
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Name < collections[j].Name
+	})
+
+	return collections, nil
+}
+
+/*
+Collection returns the collection with the given name.
+*/
+func (s *Memory) Collection(name string) (*model.Collection, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	collection, ok := s.collections[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyCollection(collection), nil
+}
+
+/*
+SaveCollection stores the collection, a collection with the same name is replaced.
+*/
+func (s *Memory) SaveCollection(collection *model.Collection) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collections[collection.Name] = *copyCollection(*collection)
+
+	return nil
+}
+
+/*
+RemoveCollection removes the collection with the given name.
+*/
+func (s *Memory) RemoveCollection(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.collections[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.collections, name)
+
+	return nil
+}
+
+/*
+Users returns all the users ordered by name.
+*/
+func (s *Memory) Users() ([]model.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]model.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	return users, nil
+}
+
+/*
+User returns the user with the given name.
+*/
+func (s *Memory) User(name string) (*model.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, ok := s.users[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+/*
+SaveUser stores the user, a user with the same name is replaced.
+*/
+func (s *Memory) SaveUser(user *model.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[user.Name] = *user
+
+	return nil
+}
+
+/*
+RemoveUser removes the user with the given name.
+*/
+func (s *Memory) RemoveUser(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.users[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.users, name)
+
+	return nil
+}
+
+/*
+Close does nothing, the in-memory store has nothing to close.
+*/
+func (s *Memory) Close() error {
+	return nil
+}
+
+/*
+checkURL returns ErrDuplicateURL when a watcher other than the watcher with the given ID has the URL, the caller holds
+the lock.
+*/
+func (s *Memory) checkURL(url string, id int) error {
+	for _, watcher := range s.watchers {
+		if watcher.URL == url && watcher.ID != id {
+			return ErrDuplicateURL
+		}
+	}
+
+	return nil
+}
+
+/*
+put stores a copy of the watcher without its price history, the caller holds the lock.
+*/
+func (s *Memory) put(watcher *model.Watcher) {
+	stored := *copyWatcher(*watcher)
+	stored.PriceHistory = nil
+	s.watchers[watcher.ID] = stored
+}
+
+/*
+copyWatcher returns a copy of the watcher that shares nothing with it, so callers can not change the stored watcher.
+*/
+func copyWatcher(watcher model.Watcher) *model.Watcher {
+	if watcher.LastPrice != nil {
+		last := *watcher.LastPrice
+		watcher.LastPrice = &last
+	}
+	if watcher.LowestPrice != nil {
+		lowest := *watcher.LowestPrice
+		watcher.LowestPrice = &lowest
+	}
+
+	// Copy into new slices of the same length so empty slices stay empty instead of becoming nil.
+	if watcher.PriceHistory != nil {
+		watcher.PriceHistory = append(make([]model.Price, 0, len(watcher.PriceHistory)), watcher.PriceHistory...)
+	}
+	if watcher.Tags != nil {
+		watcher.Tags = append(make([]string, 0, len(watcher.Tags)), watcher.Tags...)
+	}
+	if watcher.Subscribers != nil {
+		subscriptions := make([]model.Subscription, 0, len(watcher.Subscribers))
+		for _, subscription := range watcher.Subscribers {
+			subscriptions = append(subscriptions, copySubscription(subscription))
+		}
+		watcher.Subscribers = subscriptions
+	}
+	if watcher.AlertRules != nil {
+		watcher.AlertRules = append(make([]model.AlertRule, 0, len(watcher.AlertRules)), watcher.AlertRules...)
+	}
+	if watcher.Alerts != nil {
+		watcher.Alerts = append(make([]model.Alert, 0, len(watcher.Alerts)), watcher.Alerts...)
+	}
+
+	return &watcher
+}
+
+/*
+copySubscription returns a copy of the subscription that does not share its tags, alert rules and alerts.
+*/
+func copySubscription(subscription model.Subscription) model.Subscription {
+	if subscription.Tags != nil {
+		subscription.Tags = append(make([]string, 0, len(subscription.Tags)), subscription.Tags...)
+	}
+	if subscription.AlertRules != nil {
+		subscription.AlertRules = append(make([]model.AlertRule, 0, len(subscription.AlertRules)), subscription.AlertRules...)
+	}
+	if subscription.Alerts != nil {
+		subscription.Alerts = append(make([]model.Alert, 0, len(subscription.Alerts)), subscription.Alerts...)
+	}
+
+	return subscription
+}
+
+/*
+copyCollection returns a copy of the collection that does not share its tags.
+*/
+func copyCollection(collection model.Collection) *model.Collection {
+	if collection.Tags != nil {
+		collection.Tags = append(make([]string, 0, len(collection.Tags)), collection.Tags...)
+	}
+
+	return &collection
+}
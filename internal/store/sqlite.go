@@ -0,0 +1,930 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/pricewatcher/internal/rates"
+
+	// The SQLite driver for database/sql, it needs cgo.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchemaVersion is the version of the SQLite schema, it is stored in the user_version pragma of the database.
+const sqliteSchemaVersion = 5
+
+// sqliteSchema creates the tables, the amounts are exact decimal strings and the timestamps are UTC in sqliteTimeFormat
+// so they sort as text and work with the SQLite date functions.
+const sqliteSchema = `
+CREATE TABLE watchers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL,
+	domain TEXT NOT NULL,
+	availability TEXT NOT NULL DEFAULT '',
+	gtin TEXT NOT NULL DEFAULT '',
+	last_checked TEXT,
+	is_checking INTEGER NOT NULL DEFAULT 0,
+	last_price_amount TEXT,
+	last_price_currency TEXT,
+	last_price_timestamp TEXT,
+	lowest_price_amount TEXT,
+	lowest_price_currency TEXT,
+	lowest_price_timestamp TEXT,
+	alert_rules TEXT NOT NULL DEFAULT 'null',
+	alerts TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE prices (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	watcher_id INTEGER NOT NULL REFERENCES watchers (id) ON DELETE CASCADE,
+	amount TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	timestamp TEXT NOT NULL
+);
+
+CREATE INDEX prices_watcher_timestamp ON prices (watcher_id, timestamp, id);
+
+CREATE TABLE rates (
+	date TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	rate TEXT NOT NULL,
+	PRIMARY KEY (date, currency)
+);
+`
+
+// sqliteMigrations change the schema from the version of their index to the next version, the first creates the tables.
+var sqliteMigrations = []string{
+	sqliteSchema,
+	// Version 2 adds the tags of the watchers and the collections.
+	`
+	ALTER TABLE watchers ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+
+	CREATE TABLE collections (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '[]'
+	);
+	`,
+	// Version 3 marks the names that were set by a user.
+	`
+	ALTER TABLE watchers ADD COLUMN custom_name INTEGER NOT NULL DEFAULT 0;
+	`,
+	// Version 4 indexes the URLs, they are checked for duplicates whenever a watcher is added or changed.
+	`
+	CREATE INDEX watchers_url ON watchers (url);
+	`,
+	// Version 5 adds the subscriptions of the watchers and the users.
+	`
+	ALTER TABLE watchers ADD COLUMN subscribers TEXT NOT NULL DEFAULT '[]';
+
+	CREATE TABLE users (
+		name TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL,
+		admin INTEGER NOT NULL DEFAULT 0,
+		created TEXT NOT NULL
+	);
+	`,
+}
+
+// sqliteTimeFormat is the format of the timestamps, always in UTC and with a fixed amount of decimals so they sort as
+// text.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// watcherColumns are the columns of the watchers table without the ID, in the order of watcherValues.
+var watcherColumns = []string{
+	"name",
+	"custom_name",
+	"url",
+	"domain",
+	"availability",
+	"gtin",
+	"last_checked",
+	"is_checking",
+	"last_price_amount",
+	"last_price_currency",
+	"last_price_timestamp",
+	"lowest_price_amount",
+	"lowest_price_currency",
+	"lowest_price_timestamp",
+	"alert_rules",
+	"alerts",
+	"tags",
+	"subscribers",
+}
+
+// SQLite is a store in a SQLite database, other processes can use the database at the same time.
+type SQLite struct {
+	db *sql.DB
+}
+
+// scanner is a sql.Row or sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+/*
+OpenSQLite opens the SQLite database at the given path and creates the tables when the database is new, it waits up to
+the timeout when another process is writing to the database.
+*/
+func OpenSQLite(path string, timeout time.Duration) (*SQLite, error) {
+	db, err := sql.Open(
+		"sqlite3",
+		fmt.Sprintf(
+			"file:%s?_busy_timeout=%d&_foreign_keys=on&_journal_mode=WAL&_txlock=immediate",
+			path,
+			timeout.Milliseconds(),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLite{db: db}
+	if err := s.createSchema(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+/*
+Add stores a new watcher and sets its ID, the transactions take the write lock when they begin so the URL check can not
+race with another process.
+*/
+func (s *SQLite) Add(watcher *model.Watcher) error {
+	values, err := watcherValues(watcher)
+	if err != nil {
+		return err
+	}
+
+	return s.transaction(func(tx *sql.Tx) error {
+		if err := checkSQLiteURL(tx, watcher.URL, 0); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(
+			fmt.Sprintf(
+				"INSERT INTO watchers (%s) VALUES (%s)",
+				strings.Join(watcherColumns, ", "),
+				placeholders(len(watcherColumns)),
+			),
+			values...,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		watcher.ID = int(id)
+
+		return nil
+	})
+}
+
+/*
+Get returns the watcher with the given ID.
+*/
+func (s *SQLite) Get(id int) (*model.Watcher, error) {
+	return getWatcher(s.db.QueryRow(selectWatchers()+" WHERE id = ?", id))
+}
+
+/*
+List returns all the watchers ordered by ID.
+*/
+func (s *SQLite) List() ([]model.Watcher, error) {
+	rows, err := s.db.Query(selectWatchers() + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchers := []model.Watcher{}
+	for rows.Next() {
+		watcher, err := scanWatcher(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		watchers = append(watchers, *watcher)
+	}
+
+	return watchers, rows.Err()
+}
+
+/*
+Remove removes the watcher with the given ID, its price history is removed by the foreign key.
+*/
+func (s *SQLite) Remove(id int) error {
+	result, err := s.db.Exec("DELETE FROM watchers WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+/*
+RemoveAll removes all the watchers and their price histories, returns the IDs of the removed watchers.
+*/
+func (s *SQLite) RemoveAll() ([]int, error) {
+	var ids []int
+
+	err := s.transaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id FROM watchers ORDER BY id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM prices"); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM watchers")
+		return err
+	})
+
+	return ids, err
+}
+
+/*
+Update changes the watcher in a single transaction, nothing changes when update fails.
+*/
+func (s *SQLite) Update(id int, update func(watcher *model.Watcher) error) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		watcher, err := getWatcher(tx.QueryRow(selectWatchers()+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+
+		url := watcher.URL
+		if err := update(watcher); err != nil {
+			return err
+		}
+
+		if watcher.URL != url {
+			if err := checkSQLiteURL(tx, watcher.URL, id); err != nil {
+				return err
+			}
+		}
+
+		values, err := watcherValues(watcher)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			fmt.Sprintf("UPDATE watchers SET %s = ? WHERE id = ?", strings.Join(watcherColumns, " = ?, ")),
+			append(values, id)...,
+		)
+		return err
+	})
+}
+
+/*
+AppendPrice adds the price to the history of the watcher in the same transaction as the changes update makes.
+*/
+func (s *SQLite) AppendPrice(id int, price model.Price, update func(watcher *model.Watcher) error) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		watcher, err := getWatcher(tx.QueryRow(selectWatchers()+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+
+		if err := update(watcher); err != nil {
+			return err
+		}
+
+		if err := insertPrices(tx, id, []model.Price{price}); err != nil {
+			return err
+		}
+
+		values, err := watcherValues(watcher)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			fmt.Sprintf("UPDATE watchers SET %s = ? WHERE id = ?", strings.Join(watcherColumns, " = ?, ")),
+			append(values, id)...,
+		)
+		return err
+	})
+}
+
+/*
+History returns the prices of the watcher in the given time range ordered by timestamp.
+*/
+func (s *SQLite) History(id int, from, to time.Time) ([]model.Price, error) {
+	query := "SELECT amount, currency, timestamp FROM prices WHERE watcher_id = ?"
+	args := []interface{}{id}
+
+	if !from.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, formatTime(from))
+	}
+
+	if !to.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, formatTime(to))
+	}
+
+	rows, err := s.db.Query(query+" ORDER BY timestamp, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []model.Price{}
+	for rows.Next() {
+		var amount, currency, timestamp sql.NullString
+		if err := rows.Scan(&amount, &currency, &timestamp); err != nil {
+			return nil, err
+		}
+
+		price, err := scanPrice(amount, currency, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, *price)
+	}
+
+	return prices, rows.Err()
+}
+
+/*
+Import stores the watcher with its ID and its price history, later watchers get an ID after the highest imported ID.
+*/
+func (s *SQLite) Import(watcher *model.Watcher, history []model.Price) error {
+	values, err := watcherValues(watcher)
+	if err != nil {
+		return err
+	}
+
+	return s.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			fmt.Sprintf(
+				"INSERT INTO watchers (id, %s) VALUES (?, %s)",
+				strings.Join(watcherColumns, ", "),
+				placeholders(len(watcherColumns)),
+			),
+			append([]interface{}{watcher.ID}, values...)...,
+		)
+		if err != nil {
+			return fmt.Errorf("could not import watcher %d: %s", watcher.ID, err.Error())
+		}
+
+		return insertPrices(tx, watcher.ID, history)
+	})
+}
+
+/*
+StoreRates stores the exchange rates of the given days, the rates of a day that was already stored are replaced.
+*/
+func (s *SQLite) StoreRates(days []rates.Day) error {
+	return s.transaction(func(tx *sql.Tx) error {
+		for _, day := range days {
+			date := day.Date.Format(rateDateFormat)
+			if _, err := tx.Exec("DELETE FROM rates WHERE date = ?", date); err != nil {
+				return err
+			}
+
+			for currency, rate := range day.Rates {
+				_, err := tx.Exec(
+					"INSERT INTO rates (date, currency, rate) VALUES (?, ?, ?)",
+					date,
+					currency,
+					rate.RatString(),
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+LoadRates returns the stored exchange rates of all the days ordered by day.
+*/
+func (s *SQLite) LoadRates() ([]rates.Day, error) {
+	rows, err := s.db.Query("SELECT date, currency, rate FROM rates ORDER BY date")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []rates.Day
+	for rows.Next() {
+		var date, currency, rate string
+		if err := rows.Scan(&date, &currency, &rate); err != nil {
+			return nil, err
+		}
+
+		if len(days) == 0 || days[len(days)-1].Date.Format(rateDateFormat) != date {
+			parsed, err := time.Parse(rateDateFormat, date)
+			if err != nil {
+				return nil, err
+			}
+
+			days = append(days, rates.Day{Date: parsed, Rates: map[string]*big.Rat{}})
+		}
+
+		value, ok := new(big.Rat).SetString(rate)
+		if !ok {
+			return nil, fmt.Errorf("invalid stored exchange rate '%s' for %s on %s", rate, currency, date)
+		}
+
+		days[len(days)-1].Rates[currency] = value
+	}
+
+	return days, rows.Err()
+}
+
+/*
+Collections returns all the collections ordered by name.
+*/
+func (s *SQLite) Collections() ([]model.Collection, error) {
+	rows, err := s.db.Query("SELECT name, description, tags FROM collections ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []model.Collection{}
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, *collection)
+	}
+
+	return collections, rows.Err()
+}
+
+/*
+Collection returns the collection with the given name.
+*/
+func (s *SQLite) Collection(name string) (*model.Collection, error) {
+	collection, err := scanCollection(s.db.QueryRow("SELECT name, description, tags FROM collections WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return collection, err
+}
+
+/*
+SaveCollection stores the collection, a collection with the same name is replaced.
+*/
+func (s *SQLite) SaveCollection(collection *model.Collection) error {
+	tags, err := json.Marshal(collection.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"INSERT OR REPLACE INTO collections (name, description, tags) VALUES (?, ?, ?)",
+		collection.Name,
+		collection.Description,
+		string(tags),
+	)
+	return err
+}
+
+/*
+RemoveCollection removes the collection with the given name.
+*/
+func (s *SQLite) RemoveCollection(name string) error {
+	result, err := s.db.Exec("DELETE FROM collections WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+/*
+Users returns all the users ordered by name.
+*/
+func (s *SQLite) Users() ([]model.User, error) {
+	rows, err := s.db.Query("SELECT name, token_hash, admin, created FROM users ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+/*
+User returns the user with the given name.
+*/
+func (s *SQLite) User(name string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT name, token_hash, admin, created FROM users WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return user, err
+}
+
+/*
+SaveUser stores the user, a user with the same name is replaced.
+*/
+func (s *SQLite) SaveUser(user *model.User) error {
+	_, err := s.db.Exec(
+		"INSERT OR REPLACE INTO users (name, token_hash, admin, created) VALUES (?, ?, ?, ?)",
+		user.Name,
+		user.TokenHash,
+		user.Admin,
+		formatTime(user.Created),
+	)
+	return err
+}
+
+/*
+RemoveUser removes the user with the given name.
+*/
+func (s *SQLite) RemoveUser(name string) error {
+	result, err := s.db.Exec("DELETE FROM users WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+/*
+Close closes the database.
+*/
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+/*
+createSchema creates the tables in a new database and brings an older schema up to date, a database with a newer
+schema than this version supports is an error.
+*/
+func (s *SQLite) createSchema() error {
+	return s.transaction(func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			return err
+		}
+
+		if version > sqliteSchemaVersion {
+			return fmt.Errorf(
+				"the database has schema version %d, this version of pricewatcher supports up to version %d",
+				version,
+				sqliteSchemaVersion,
+			)
+		}
+
+		if version == sqliteSchemaVersion {
+			return nil
+		}
+
+		for _, migration := range sqliteMigrations[version:] {
+			if _, err := tx.Exec(migration); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion))
+		return err
+	})
+}
+
+/*
+transaction runs the function in a transaction, which is committed when the function succeeds and rolled back
+otherwise.
+*/
+func (s *SQLite) transaction(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+checkSQLiteURL returns ErrDuplicateURL when a watcher other than the watcher with the given ID has the URL.
+*/
+func checkSQLiteURL(tx *sql.Tx, url string, id int) error {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM watchers WHERE url = ? AND id != ?)", url, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrDuplicateURL
+	}
+
+	return nil
+}
+
+/*
+insertPrices adds the prices to the history of the watcher.
+*/
+func insertPrices(tx *sql.Tx, id int, prices []model.Price) error {
+	for _, price := range prices {
+		_, err := tx.Exec(
+			"INSERT INTO prices (watcher_id, amount, currency, timestamp) VALUES (?, ?, ?, ?)",
+			id,
+			price.Value.Decimal(),
+			price.Value.Currency,
+			formatTime(price.Timestamp),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+selectWatchers returns the query that selects the ID and the watcherColumns of the watchers.
+*/
+func selectWatchers() string {
+	return fmt.Sprintf("SELECT id, %s FROM watchers", strings.Join(watcherColumns, ", "))
+}
+
+/*
+getWatcher scans a single watcher, a missing row is ErrNotFound.
+*/
+func getWatcher(row *sql.Row) (*model.Watcher, error) {
+	watcher, err := scanWatcher(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return watcher, err
+}
+
+/*
+scanWatcher reads a row of the selectWatchers query.
+*/
+func scanWatcher(row scanner) (*model.Watcher, error) {
+	watcher := &model.Watcher{}
+
+	var lastChecked, alertRules, alerts, tags, subscribers sql.NullString
+	var last, lowest [3]sql.NullString
+
+	err := row.Scan(
+		&watcher.ID,
+		&watcher.Name,
+		&watcher.CustomName,
+		&watcher.URL,
+		&watcher.Domain,
+		&watcher.Availability,
+		&watcher.GTIN,
+		&lastChecked,
+		&watcher.IsChecking,
+		&last[0],
+		&last[1],
+		&last[2],
+		&lowest[0],
+		&lowest[1],
+		&lowest[2],
+		&alertRules,
+		&alerts,
+		&tags,
+		&subscribers,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastChecked.Valid {
+		if watcher.LastChecked, err = time.Parse(time.RFC3339Nano, lastChecked.String); err != nil {
+			return nil, err
+		}
+	}
+
+	if watcher.LastPrice, err = scanPrice(last[0], last[1], last[2]); err != nil {
+		return nil, err
+	}
+
+	if watcher.LowestPrice, err = scanPrice(lowest[0], lowest[1], lowest[2]); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(alertRules.String), &watcher.AlertRules); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(alerts.String), &watcher.Alerts); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags.String), &watcher.Tags); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(subscribers.String), &watcher.Subscribers); err != nil {
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+/*
+scanCollection returns the collection in the row.
+*/
+func scanCollection(row scanner) (*model.Collection, error) {
+	collection := &model.Collection{}
+
+	var tags string
+	if err := row.Scan(&collection.Name, &collection.Description, &tags); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags), &collection.Tags); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+/*
+scanUser returns the user in the row.
+*/
+func scanUser(row scanner) (*model.User, error) {
+	user := &model.User{}
+
+	var created string
+	if err := row.Scan(&user.Name, &user.TokenHash, &user.Admin, &created); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if user.Created, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+/*
+scanPrice returns the price for the amount, currency and timestamp columns, or nil when they are NULL.
+*/
+func scanPrice(amount, currency, timestamp sql.NullString) (*model.Price, error) {
+	if !amount.Valid {
+		return nil, nil
+	}
+
+	value, err := money.Parse(amount.String, currency.String)
+	if err != nil {
+		return nil, err
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, timestamp.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Price{Value: value, Timestamp: at}, nil
+}
+
+/*
+watcherValues returns the values of the watcherColumns for the watcher.
+*/
+func watcherValues(watcher *model.Watcher) ([]interface{}, error) {
+	alertRules, err := json.Marshal(watcher.AlertRules)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := json.Marshal(watcher.Alerts)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := json.Marshal(watcher.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribers, err := json.Marshal(watcher.Subscribers)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastChecked interface{}
+	if !watcher.LastChecked.IsZero() {
+		lastChecked = formatTime(watcher.LastChecked)
+	}
+
+	values := []interface{}{
+		watcher.Name,
+		watcher.CustomName,
+		watcher.URL,
+		watcher.Domain,
+		watcher.Availability,
+		watcher.GTIN,
+		lastChecked,
+		watcher.IsChecking,
+	}
+	values = append(values, priceValues(watcher.LastPrice)...)
+	values = append(values, priceValues(watcher.LowestPrice)...)
+
+	return append(values, string(alertRules), string(alerts), string(tags), string(subscribers)), nil
+}
+
+/*
+priceValues returns the amount, currency and timestamp column values of the price, NULL for a nil price.
+*/
+func priceValues(price *model.Price) []interface{} {
+	if price == nil {
+		return []interface{}{nil, nil, nil}
+	}
+
+	return []interface{}{price.Value.Decimal(), price.Value.Currency, formatTime(price.Timestamp)}
+}
+
+/*
+formatTime formats the time as stored in the database.
+*/
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+/*
+placeholders returns n comma separated query placeholders.
+*/
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/rates"
+)
+
+var (
+	// ErrNotFound is returned when no watcher exists with the given ID, or no collection or user with the given name.
+	ErrNotFound = fmt.Errorf("key not found")
+	// ErrInUse is returned when a bolt database can not be opened because another process, like the webserver, has it
+	// open.
+	ErrInUse = fmt.Errorf("the database is in use by another process, for example the webserver")
+	// ErrDuplicateURL is returned when another watcher already watches the URL of a new or changed watcher.
+	ErrDuplicateURL = fmt.Errorf("a watcher for this url already exists")
+)
+
+// The storage backends that can be selected with the database.driver config key.
+const (
+	DriverBolt   = "bolt"
+	DriverSQLite = "sqlite"
+)
+
+/*
+Open opens the store of the given driver at the given path.
+*/
+func Open(driver, path string, timeout time.Duration) (Store, error) {
+	switch driver {
+	case DriverBolt:
+		return OpenBolt(path, timeout)
+	case DriverSQLite:
+		return OpenSQLite(path, timeout)
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s', use '%s' or '%s'", driver, DriverBolt, DriverSQLite)
+	}
+}
+
+// Store stores the watchers, their price histories and the exchange rates, implementations are safe for concurrent use.
+// Watchers are returned without their price history, it is read with History.
+type Store interface {
+	rates.Storage
+
+	// Add stores a new watcher and sets its ID, it fails with ErrDuplicateURL when another watcher has its URL. The URL
+	// is checked in the same transaction, so two processes can not add the same URL at the same time.
+	Add(watcher *model.Watcher) error
+	// Get returns the watcher with the given ID.
+	Get(id int) (*model.Watcher, error)
+	// List returns all the watchers ordered by ID.
+	List() ([]model.Watcher, error)
+	// Remove removes the watcher with the given ID and its price history.
+	Remove(id int) error
+	// RemoveAll removes all the watchers and their price histories, returns the IDs of the removed watchers.
+	RemoveAll() ([]int, error)
+	// Update changes the watcher with the given ID in a single transaction, update is called with the stored watcher
+	// and its changes are stored unless it returns an error. The ID and the price history can not be changed, a URL
+	// that another watcher has fails with ErrDuplicateURL.
+	Update(id int, update func(watcher *model.Watcher) error) error
+	// AppendPrice adds the price to the history of the watcher, update is called with the watcher before the price is
+	// added and its changes are stored together with the price.
+	AppendPrice(id int, price model.Price, update func(watcher *model.Watcher) error) error
+	// History returns the prices of the watcher from the given time up to and including the given time ordered by
+	// timestamp, a zero time leaves that side of the range open.
+	History(id int, from, to time.Time) ([]model.Price, error)
+	// Import stores the watcher with its ID and its price history, it is used to copy watchers between stores.
+	Import(watcher *model.Watcher, history []model.Price) error
+	// Collections returns all the collections ordered by name.
+	Collections() ([]model.Collection, error)
+	// Collection returns the collection with the given name.
+	Collection(name string) (*model.Collection, error)
+	// SaveCollection stores the collection, a collection with the same name is replaced.
+	SaveCollection(collection *model.Collection) error
+	// RemoveCollection removes the collection with the given name.
+	RemoveCollection(name string) error
+	// Users returns all the users ordered by name.
+	Users() ([]model.User, error)
+	// User returns the user with the given name.
+	User(name string) (*model.User, error)
+	// SaveUser stores the user, a user with the same name is replaced.
+	SaveUser(user *model.User) error
+	// RemoveUser removes the user with the given name.
+	RemoveUser(name string) error
+	// Backup writes a consistent snapshot of the database to the writer while the store stays in use, returns the
+	// amount of bytes written.
+	Backup(w io.Writer) (int64, error)
+	// Close closes the store.
+	Close() error
+}
@@ -0,0 +1,431 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/pricewatcher/internal/testutil"
+)
+
+// backend opens an empty store of one of the storage backends, the returned function closes and removes it.
+type backend struct {
+	name string
+	open func(t *testing.T) (Store, func())
+}
+
+// backends are the storage backends that every store test runs against, they all have to behave the same.
+var backends = []backend{
+	{name: DriverBolt, open: openFileStore(DriverBolt)},
+	{name: DriverSQLite, open: openFileStore(DriverSQLite)},
+	{name: "memory", open: func(t *testing.T) (Store, func()) {
+		return NewMemory(), func() {}
+	}},
+}
+
+/*
+openFileStore returns a function that opens a store of the given driver in a temporary directory.
+*/
+func openFileStore(driver string) func(t *testing.T) (Store, func()) {
+	return func(t *testing.T) (Store, func()) {
+		t.Helper()
+
+		dir, removeDir := testutil.TempDir(t)
+
+		s, err := Open(driver, filepath.Join(dir, "pricewatcher.db"), time.Second)
+		if err != nil {
+			removeDir()
+			t.Fatal(err)
+		}
+
+		return s, func() {
+			if err := s.Close(); err != nil {
+				t.Error(err)
+			}
+			removeDir()
+		}
+	}
+}
+
+/*
+addWatchers adds a watcher for every URL and returns their IDs.
+*/
+func addWatchers(t *testing.T, s Store, urls ...string) []int {
+	t.Helper()
+
+	ids := make([]int, 0, len(urls))
+	for _, url := range urls {
+		watcher := &model.Watcher{URL: url, Domain: "shop.example"}
+		if err := s.Add(watcher); err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, watcher.ID)
+	}
+
+	return ids
+}
+
+/*
+price returns a price in euro cents at the given minute of the day.
+*/
+func price(cents int64, minute int) model.Price {
+	return model.Price{
+		Value:     money.New(cents, "EUR"),
+		Timestamp: time.Date(2020, 3, 13, 12, minute, 0, 0, time.UTC),
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []string
+		wantErr error
+	}{
+		{name: "one watcher", urls: []string{"https://shop.example/kettle"}},
+		{name: "different urls", urls: []string{"https://shop.example/kettle", "https://shop.example/toaster"}},
+		{
+			name:    "duplicate url",
+			urls:    []string{"https://shop.example/kettle", "https://shop.example/kettle"},
+			wantErr: ErrDuplicateURL,
+		},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				s, closeStore := b.open(t)
+				defer closeStore()
+
+				var err error
+				ids := map[int]bool{}
+				for _, url := range tt.urls {
+					watcher := &model.Watcher{URL: url, Domain: "shop.example", Tags: []string{"kitchen"}}
+					if err = s.Add(watcher); err != nil {
+						break
+					}
+
+					if watcher.ID == 0 || ids[watcher.ID] {
+						t.Fatalf("expected a new ID, got %d", watcher.ID)
+					}
+					ids[watcher.ID] = true
+
+					stored, err := s.Get(watcher.ID)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if stored.URL != url || len(stored.Tags) != 1 || stored.Tags[0] != "kitchen" {
+						t.Errorf("expected the stored watcher for '%s', got %+v", url, stored)
+					}
+				}
+
+				if err != tt.wantErr {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+
+				watchers, err := s.List()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(watchers) != len(ids) {
+					t.Errorf("expected %d watchers, got %d", len(ids), len(watchers))
+				}
+
+				for i := 1; i < len(watchers); i++ {
+					if watchers[i-1].ID >= watchers[i].ID {
+						t.Errorf("expected the watchers ordered by ID, got %d before %d", watchers[i-1].ID, watchers[i].ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	errUpdate := fmt.Errorf("update failed")
+
+	tests := []struct {
+		name     string
+		id       func(ids []int) int
+		update   func(watcher *model.Watcher) error
+		wantErr  error
+		wantName string
+		wantURL  string
+	}{
+		{
+			name: "change the name and url",
+			id:   func(ids []int) int { return ids[0] },
+			update: func(watcher *model.Watcher) error {
+				watcher.Name = "Kettle"
+				watcher.URL = "https://shop.example/kettle-2"
+				return nil
+			},
+			wantName: "Kettle",
+			wantURL:  "https://shop.example/kettle-2",
+		},
+		{
+			name: "url of another watcher",
+			id:   func(ids []int) int { return ids[0] },
+			update: func(watcher *model.Watcher) error {
+				watcher.Name = "Kettle"
+				watcher.URL = "https://shop.example/toaster"
+				return nil
+			},
+			wantErr: ErrDuplicateURL,
+			wantURL: "https://shop.example/kettle",
+		},
+		{
+			name: "update fails",
+			id:   func(ids []int) int { return ids[0] },
+			update: func(watcher *model.Watcher) error {
+				watcher.Name = "Kettle"
+				return errUpdate
+			},
+			wantErr: errUpdate,
+			wantURL: "https://shop.example/kettle",
+		},
+		{
+			name: "unknown watcher",
+			id:   func(ids []int) int { return ids[1] + 1 },
+			update: func(watcher *model.Watcher) error {
+				return nil
+			},
+			wantErr: ErrNotFound,
+			wantURL: "https://shop.example/kettle",
+		},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				s, closeStore := b.open(t)
+				defer closeStore()
+
+				ids := addWatchers(t, s, "https://shop.example/kettle", "https://shop.example/toaster")
+
+				if err := s.Update(tt.id(ids), tt.update); err != tt.wantErr {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+
+				stored, err := s.Get(ids[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if stored.ID != ids[0] || stored.Name != tt.wantName || stored.URL != tt.wantURL {
+					t.Errorf("expected name '%s' and url '%s', got %+v", tt.wantName, tt.wantURL, stored)
+				}
+			})
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	// The prices are appended out of order, the two prices at minute 20 keep the order they were appended in.
+	appended := []model.Price{price(1999, 10), price(1899, 30), price(1799, 20), price(1699, 20), price(1599, 0)}
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want []int64
+	}{
+		{name: "all prices", want: []int64{1599, 1999, 1799, 1699, 1899}},
+		{name: "from a time", from: price(0, 20).Timestamp, want: []int64{1799, 1699, 1899}},
+		{name: "up to and including a time", to: price(0, 20).Timestamp, want: []int64{1599, 1999, 1799, 1699}},
+		{name: "time range", from: price(0, 5).Timestamp, to: price(0, 25).Timestamp, want: []int64{1999, 1799, 1699}},
+		{name: "empty range", from: price(0, 40).Timestamp, want: []int64{}},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				s, closeStore := b.open(t)
+				defer closeStore()
+
+				id := addWatchers(t, s, "https://shop.example/kettle")[0]
+
+				for _, p := range appended {
+					p := p
+					err := s.AppendPrice(id, p, func(watcher *model.Watcher) error {
+						watcher.LastPrice = &p
+						return nil
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				history, err := s.History(id, tt.from, tt.to)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := make([]int64, 0, len(history))
+				for _, p := range history {
+					got = append(got, p.Value.Amount)
+				}
+
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("expected prices %v, got %v", tt.want, got)
+				}
+
+				stored, err := s.Get(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				last := appended[len(appended)-1]
+				if stored.LastPrice == nil || stored.LastPrice.Value != last.Value || !stored.LastPrice.Timestamp.Equal(last.Timestamp) {
+					t.Errorf("expected last price %v, got %v", last, stored.LastPrice)
+				}
+
+				if stored.PriceHistory != nil {
+					t.Errorf("expected the watcher without its price history, got %d prices", len(stored.PriceHistory))
+				}
+			})
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name       string
+		remove     func(s Store, ids []int) error
+		wantLeft   int
+		wantErr    error
+		wantGetOK  bool
+		wantPrices int
+	}{
+		{
+			name:     "one watcher",
+			remove:   func(s Store, ids []int) error { return s.Remove(ids[0]) },
+			wantLeft: 1,
+		},
+		{
+			name: "all watchers",
+			remove: func(s Store, ids []int) error {
+				removed, err := s.RemoveAll()
+				if err == nil && len(removed) != len(ids) {
+					return fmt.Errorf("expected %d removed IDs, got %d", len(ids), len(removed))
+				}
+				return err
+			},
+		},
+		{
+			name:       "unknown watcher",
+			remove:     func(s Store, ids []int) error { return s.Remove(ids[1] + 1) },
+			wantLeft:   2,
+			wantErr:    ErrNotFound,
+			wantGetOK:  true,
+			wantPrices: 1,
+		},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				s, closeStore := b.open(t)
+				defer closeStore()
+
+				ids := addWatchers(t, s, "https://shop.example/kettle", "https://shop.example/toaster")
+				if err := s.AppendPrice(ids[0], price(1999, 0), func(*model.Watcher) error { return nil }); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tt.remove(s, ids); err != tt.wantErr {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+
+				watchers, err := s.List()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(watchers) != tt.wantLeft {
+					t.Errorf("expected %d watchers left, got %d", tt.wantLeft, len(watchers))
+				}
+
+				if _, err := s.Get(ids[0]); (err == nil) != tt.wantGetOK {
+					t.Errorf("expected the first watcher to be found: %t, got error %v", tt.wantGetOK, err)
+				}
+
+				history, err := s.History(ids[0], time.Time{}, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(history) != tt.wantPrices {
+					t.Errorf("expected %d prices in the history, got %d", tt.wantPrices, len(history))
+				}
+			})
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	for _, from := range backends {
+		for _, to := range backends {
+			t.Run(from.name+"/"+to.name, func(t *testing.T) {
+				source, closeSource := from.open(t)
+				defer closeSource()
+
+				target, closeTarget := to.open(t)
+				defer closeTarget()
+
+				ids := addWatchers(t, source, "https://shop.example/kettle", "https://shop.example/toaster")
+				if err := source.Remove(ids[0]); err != nil {
+					t.Fatal(err)
+				}
+
+				for _, p := range []model.Price{price(1999, 0), price(1899, 10)} {
+					if err := source.AppendPrice(ids[1], p, func(*model.Watcher) error { return nil }); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				copied, err := Copy(source, target)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if copied != 1 {
+					t.Fatalf("expected 1 copied watcher, got %d", copied)
+				}
+
+				stored, err := target.Get(ids[1])
+				if err != nil {
+					t.Fatalf("expected the watcher to keep its ID %d: %v", ids[1], err)
+				}
+
+				if stored.URL != "https://shop.example/toaster" {
+					t.Errorf("expected the copied watcher, got %+v", stored)
+				}
+
+				history, err := target.History(ids[1], time.Time{}, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(history) != 2 {
+					t.Errorf("expected 2 copied prices, got %d", len(history))
+				}
+
+				// A new watcher gets an ID after the copied watchers, also when the last watcher was removed.
+				added := addWatchers(t, target, "https://shop.example/blender")[0]
+				if added <= ids[1] {
+					t.Errorf("expected a new ID after %d, got %d", ids[1], added)
+				}
+
+				if _, err := Copy(source, target); err == nil {
+					t.Error("expected an error when copying to a store with watchers, got nil")
+				}
+			})
+		}
+	}
+}
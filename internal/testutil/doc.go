@@ -0,0 +1,4 @@
+/*
+Package testutil contains the helpers and local stand-ins for the services the packages talk to, for use in tests.
+*/
+package testutil
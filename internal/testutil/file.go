@@ -0,0 +1,42 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+TempDir creates a temporary directory, the returned function removes it with everything in it.
+*/
+func TempDir(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "pricewatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+/*
+WriteFile writes the content to a file with the given name in a temporary directory and returns its path, the returned
+function removes it.
+*/
+func WriteFile(t *testing.T, name, content string) (string, func()) {
+	t.Helper()
+
+	dir, remove := TempDir(t)
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		remove()
+		t.Fatal(err)
+	}
+
+	return path, remove
+}
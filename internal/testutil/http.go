@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// Page is a response of the HTTP stand-in, the status defaults to 200 and the content type to HTML. A page with a
+// location redirects to it.
+type Page struct {
+	Status      int
+	ContentType string
+	Body        string
+	Location    string
+}
+
+/*
+ServePages starts an HTTP stand-in on a random local port that serves the pages by path, other paths are not found. It
+is stopped with Close.
+*/
+func ServePages(pages map[string]Page) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if page.Location != "" {
+			http.Redirect(w, r, page.Location, http.StatusFound)
+			return
+		}
+
+		if page.ContentType == "" {
+			page.ContentType = "text/html; charset=utf-8"
+		}
+		if page.Status == 0 {
+			page.Status = http.StatusOK
+		}
+
+		w.Header().Set("Content-Type", page.ContentType)
+		w.WriteHeader(page.Status)
+		_, _ = w.Write([]byte(page.Body))
+	}))
+}
@@ -0,0 +1,103 @@
+package testutil
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// SMTPMessage is a message as it was received by the SMTP stand-in.
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// SMTPServer is a local SMTP stand-in without TLS or authentication, every message it receives is sent on Messages.
+type SMTPServer struct {
+	Host     string
+	Port     string
+	Messages <-chan SMTPMessage
+	listener net.Listener
+}
+
+/*
+StartSMTP starts an SMTP stand-in on a random local port, it is stopped with Close.
+*/
+func StartSMTP(t *testing.T) *SMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan SMTPMessage, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			serveSMTP(textproto.NewConn(conn), messages)
+		}
+	}()
+
+	return &SMTPServer{Host: host, Port: port, Messages: messages, listener: listener}
+}
+
+/*
+Close stops the SMTP stand-in.
+*/
+func (s *SMTPServer) Close() {
+	_ = s.listener.Close()
+}
+
+/*
+serveSMTP handles a single SMTP session, the message is sent on the channel once the client quits.
+*/
+func serveSMTP(text *textproto.Conn, messages chan<- SMTPMessage) {
+	defer text.Close()
+
+	received := SMTPMessage{}
+	_ = text.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			received.From = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			_ = text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			received.To = append(received.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			_ = text.PrintfLine("250 OK")
+		case command == "DATA":
+			_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			received.Data = string(data)
+			_ = text.PrintfLine("250 OK")
+		case command == "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			messages <- received
+			return
+		default:
+			// EHLO, HELO, RSET and NOOP, the stand-in has no extensions.
+			_ = text.PrintfLine("250 localhost")
+		}
+	}
+}
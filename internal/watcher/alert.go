@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+)
+
+/*
+ValidateAlertRule checks if the alert rule has a known type and a usable value.
+*/
+func ValidateAlertRule(rule model.AlertRule) error {
+	switch rule.Type {
+	case model.AlertBelow:
+		amount, err := money.Parse(rule.Amount, money.DefaultCurrency)
+		if err != nil || amount.Amount <= 0 {
+			return fmt.Errorf("alert rule '%s' needs an amount above 0, for example \"99.95\"", rule.Type)
+		}
+	case model.AlertDropPercent, model.AlertDropFromLow:
+		if rule.Value <= 0 || rule.Value > 100 {
+			return fmt.Errorf("alert rule '%s' needs a percentage between 0 and 100", rule.Type)
+		}
+	case model.AlertNewLow:
+	default:
+		return fmt.Errorf("unknown alert rule '%s'", rule.Type)
+	}
+
+	return nil
+}
+
+/*
+evaluateAlerts checks the alert rules of the watcher or of one of its subscriptions against the new price and returns
+the triggered alerts, the last and lowest price of the watcher are the prices from before the new price. Only prices
+in the currency of the new price are compared.
+The "below" rule only triggers when the price crosses the value so it does not trigger again on every check.
+*/
+func evaluateAlerts(watcher *model.Watcher, rules []model.AlertRule, current model.Price) []model.Alert {
+	var alerts []model.Alert
+
+	previous, lowest := watcher.LastPrice, watcher.LowestPrice
+	if previous != nil && !previous.Value.SameCurrency(current.Value) {
+		previous = nil
+	}
+	if lowest != nil && !lowest.Value.SameCurrency(current.Value) {
+		lowest = nil
+	}
+
+	for _, rule := range rules {
+		var message string
+
+		switch rule.Type {
+		case model.AlertBelow:
+			threshold, err := money.Parse(rule.Amount, current.Value.Currency)
+			if err != nil {
+				continue
+			}
+
+			if current.Value.Less(threshold) && (previous == nil || !previous.Value.Less(threshold)) {
+				message = fmt.Sprintf("price %s is below %s", current.Value, threshold)
+			}
+		case model.AlertDropPercent:
+			if previous != nil && percentDrop(previous.Value, current.Value) >= float64(rule.Value) {
+				message = fmt.Sprintf(
+					"price dropped %.1f%% from %s to %s",
+					percentDrop(previous.Value, current.Value),
+					previous.Value,
+					current.Value,
+				)
+			}
+		case model.AlertDropFromLow:
+			if lowest != nil && percentDrop(lowest.Value, current.Value) >= float64(rule.Value) {
+				message = fmt.Sprintf(
+					"price %s is %.1f%% below the all-time low of %s",
+					current.Value,
+					percentDrop(lowest.Value, current.Value),
+					lowest.Value,
+				)
+			}
+		case model.AlertNewLow:
+			if lowest != nil && current.Value.Less(lowest.Value) {
+				message = fmt.Sprintf("price %s is a new all-time low, previous low was %s", current.Value, lowest.Value)
+			}
+		}
+
+		if message != "" {
+			alerts = append(alerts, model.Alert{
+				Rule:      rule,
+				Price:     current,
+				Message:   message,
+				Timestamp: time.Now(),
+			})
+		}
+	}
+
+	return alerts
+}
+
+/*
+percentDrop returns the percentage the price dropped from the old value to the new value, a price increase returns a
+negative percentage. Both values need to be in the same currency.
+*/
+func percentDrop(oldValue, newValue money.Money) float64 {
+	if oldValue.Amount == 0 {
+		return 0
+	}
+
+	return float64(oldValue.Amount-newValue.Amount) / float64(oldValue.Amount) * 100
+}
@@ -0,0 +1,467 @@
+package watcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+	"github.com/laetificat/pricewatcher/internal/rates"
+	"github.com/laetificat/pricewatcher/internal/store"
+)
+
+// The fields the watchers can be sorted on, a "-" in front of the field sorts descending.
+const (
+	SortID          = "id"
+	SortName        = "name"
+	SortPrice       = "price"
+	SortLastChecked = "last_checked"
+	SortPriceChange = "price_change"
+)
+
+// ErrInvalidCursor is returned when the cursor of a query is damaged or was made for another sort order.
+var ErrInvalidCursor = fmt.Errorf("the cursor is not valid for this query")
+
+// Query selects, sorts and pages the watchers of List. Every filter that is set has to match, filters that are not set
+// match all the watchers.
+type Query struct {
+	// Domain matches the domain of the watcher.
+	Domain string
+	// Name matches the watchers with this text in their name, ignoring case.
+	Name string
+	// URL matches the URL of the watcher exactly.
+	URL string
+	// URLPrefix matches the watchers with a URL that starts with it.
+	URLPrefix string
+	// Tags matches the watchers that have all the tags.
+	Tags []string
+	// Collection matches the watchers in the collection with this name, the watchers with one of its tags.
+	Collection string
+	// Subscriber matches the watchers the user with this name is subscribed to, the watchers are returned as the user
+	// sees them.
+	Subscriber string
+	// CheckedBefore and CheckedAfter match the watchers that were last checked before or after the time, watchers that
+	// were never checked are checked before any time.
+	CheckedBefore time.Time
+	CheckedAfter  time.Time
+	// MinPrice and MaxPrice match the watchers with a last price in the range, including the bounds. The bounds are in
+	// Currency when it is set, otherwise in the currency of the last price of every watcher.
+	MinPrice *float64
+	MaxPrice *float64
+	// Currency is the currency the last prices are converted to before they are compared.
+	Currency string
+	// Sort is one of the sort fields, optionally with a "-" in front, the watchers are sorted by ID by default.
+	Sort string
+	// Limit is the maximum amount of watchers in a page, 0 returns all the watchers.
+	Limit int
+	// Cursor is the cursor returned with the previous page, the watchers after that page are returned.
+	Cursor string
+}
+
+// sortKey is the position of a watcher in the sort order, the ID keeps watchers with the same value apart. A cursor is
+// the sort key of the last watcher of a page.
+type sortKey struct {
+	ID     int       `json:"i"`
+	Text   string    `json:"t,omitempty"`
+	Number *float64  `json:"n,omitempty"`
+	Time   time.Time `json:"d,omitempty"`
+}
+
+// cursor is the encoded form of a cursor, the sort order is kept to reject cursors of other orders.
+type cursor struct {
+	Sort string  `json:"s"`
+	Key  sortKey `json:"k"`
+}
+
+/*
+ParseQuery returns the query for the given values, the keys are the names of the query parameters of GET /watchers:
+domain, name, url, url_prefix, tag, collection, user, checked_before, checked_after, min_price, max_price, currency,
+sort, limit and cursor. Times are RFC 3339 times or dates, the tag param can be repeated or have a comma separated list.
+*/
+func ParseQuery(values url.Values) (Query, error) {
+	query := Query{
+		Domain:     strings.ToLower(values.Get("domain")),
+		Name:       values.Get("name"),
+		URL:        values.Get("url"),
+		URLPrefix:  values.Get("url_prefix"),
+		Collection: strings.ToLower(values.Get("collection")),
+		Subscriber: values.Get("user"),
+		Currency:   values.Get("currency"),
+		Sort:       values.Get("sort"),
+		Cursor:     values.Get("cursor"),
+	}
+
+	for _, value := range values["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag != "" {
+				query.Tags = append(query.Tags, tag)
+			}
+		}
+	}
+
+	for param, target := range map[string]*time.Time{
+		"checked_before": &query.CheckedBefore,
+		"checked_after":  &query.CheckedAfter,
+	} {
+		value := values.Get(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				return query, fmt.Errorf("given value '%s' for '%s' is not a date or RFC 3339 time", value, param)
+			}
+		}
+		*target = t
+	}
+
+	for param, target := range map[string]**float64{
+		"min_price": &query.MinPrice,
+		"max_price": &query.MaxPrice,
+	} {
+		value := values.Get(param)
+		if value == "" {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price < 0 {
+			return query, fmt.Errorf("given value '%s' for '%s' is not a positive number", value, param)
+		}
+		*target = &price
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return query, fmt.Errorf("given value '%s' for 'limit' is not a positive number", value)
+		}
+		query.Limit = limit
+	}
+
+	return query, query.Validate()
+}
+
+/*
+Validate checks the tags, the sort order, the price range, the currency and the cursor of the query.
+*/
+func (q Query) Validate() error {
+	if _, err := NormalizeTags(q.Tags); err != nil {
+		return err
+	}
+
+	if _, _, err := parseSort(q.Sort); err != nil {
+		return err
+	}
+
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MaxPrice < *q.MinPrice {
+		return fmt.Errorf("'max_price' is below 'min_price'")
+	}
+
+	if q.Currency != "" {
+		if _, err := money.NormalizeCurrency(q.Currency); err != nil {
+			return err
+		}
+	}
+
+	if q.Cursor != "" {
+		if _, err := decodeCursor(q.Cursor, q.Sort); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+find returns the page of watchers that match the query and the cursor of the next page, the cursor is empty for the
+last page. The watchers of a subscriber are personalized for it.
+*/
+func find(s store.Store, watchers []model.Watcher, query Query) ([]model.Watcher, string, error) {
+	if err := query.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	field, descending, _ := parseSort(query.Sort)
+	query.Tags, _ = NormalizeTags(query.Tags)
+
+	var collectionTags []string
+	if query.Collection != "" {
+		collection, err := Collection(s, query.Collection)
+		if err != nil {
+			return nil, "", err
+		}
+		collectionTags = collection.Tags
+	}
+
+	var table *rates.Table
+	if query.Currency != "" && (query.MinPrice != nil || query.MaxPrice != nil || field == SortPrice) {
+		var err error
+		if table, err = rates.Load(s); err != nil {
+			return nil, "", err
+		}
+	}
+
+	type entry struct {
+		watcher model.Watcher
+		key     sortKey
+	}
+
+	entries := []entry{}
+	for _, watcher := range watchers {
+		// The watchers of a subscriber are matched and sorted by the name and tags of its subscription.
+		if query.Subscriber != "" {
+			Personalize(&watcher, query.Subscriber)
+		}
+
+		price, err := lastPrice(table, &watcher, query.Currency)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !query.matches(&watcher, price) || query.Collection != "" && !hasAnyTag(&watcher, collectionTags) {
+			continue
+		}
+
+		key := sortKey{ID: watcher.ID}
+		switch field {
+		case SortName:
+			key.Text = strings.ToLower(watcher.Name)
+		case SortPrice:
+			key.Number = price
+		case SortLastChecked:
+			key.Time = watcher.LastChecked
+		case SortPriceChange:
+			if key.Number, err = priceChange(s, watcher.ID); err != nil {
+				return nil, "", err
+			}
+		}
+
+		entries = append(entries, entry{watcher, key})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key.before(entries[j].key, field, descending)
+	})
+
+	start := 0
+	if query.Cursor != "" {
+		after, _ := decodeCursor(query.Cursor, query.Sort)
+		start = sort.Search(len(entries), func(i int) bool {
+			return after.Key.before(entries[i].key, field, descending)
+		})
+	}
+
+	end, next := len(entries), ""
+	if query.Limit > 0 && start+query.Limit < len(entries) {
+		end = start + query.Limit
+		next = encodeCursor(query.Sort, entries[end-1].key)
+	}
+
+	page := make([]model.Watcher, 0, end-start)
+	for _, e := range entries[start:end] {
+		page = append(page, e.watcher)
+	}
+
+	return page, next, nil
+}
+
+/*
+matches checks the filters of the query against the watcher, price is the last price of the watcher in the currency of
+the query.
+*/
+func (q Query) matches(watcher *model.Watcher, price *float64) bool {
+	switch {
+	case q.Domain != "" && watcher.Domain != q.Domain:
+		return false
+	case q.Name != "" && !strings.Contains(strings.ToLower(watcher.Name), strings.ToLower(q.Name)):
+		return false
+	case q.URL != "" && watcher.URL != q.URL:
+		return false
+	case q.URLPrefix != "" && !strings.HasPrefix(watcher.URL, q.URLPrefix):
+		return false
+	case !hasAllTags(watcher, q.Tags):
+		return false
+	case q.Subscriber != "" && !IsSubscribed(watcher, q.Subscriber):
+		return false
+	case !q.CheckedBefore.IsZero() && !watcher.LastChecked.Before(q.CheckedBefore):
+		return false
+	case !q.CheckedAfter.IsZero() && !watcher.LastChecked.After(q.CheckedAfter):
+		return false
+	case (q.MinPrice != nil || q.MaxPrice != nil) && price == nil:
+		return false
+	case q.MinPrice != nil && *price < *q.MinPrice:
+		return false
+	case q.MaxPrice != nil && *price > *q.MaxPrice:
+		return false
+	}
+
+	return true
+}
+
+/*
+hasAllTags checks if the watcher has all the tags.
+*/
+func hasAllTags(watcher *model.Watcher, tags []string) bool {
+	for _, tag := range tags {
+		if !containsTag(watcher.Tags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+hasAnyTag checks if the watcher has one of the tags.
+*/
+func hasAnyTag(watcher *model.Watcher, tags []string) bool {
+	for _, tag := range tags {
+		if containsTag(watcher.Tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+before checks if the key sorts before the other key. Watchers without a value for the field come last in both
+directions and watchers with the same value are ordered by ID.
+*/
+func (k sortKey) before(other sortKey, field string, descending bool) bool {
+	c := 0
+
+	switch field {
+	case SortName:
+		c = strings.Compare(k.Text, other.Text)
+	case SortPrice, SortPriceChange:
+		switch {
+		case k.Number == nil && other.Number == nil:
+		case k.Number == nil:
+			return false
+		case other.Number == nil:
+			return true
+		case *k.Number < *other.Number:
+			c = -1
+		case *k.Number > *other.Number:
+			c = 1
+		}
+	case SortLastChecked:
+		switch {
+		case k.Time.Before(other.Time):
+			c = -1
+		case k.Time.After(other.Time):
+			c = 1
+		}
+	}
+
+	if descending {
+		c = -c
+	}
+
+	if c != 0 {
+		return c < 0
+	}
+
+	return k.ID < other.ID
+}
+
+/*
+parseSort returns the field and the direction of the sort order.
+*/
+func parseSort(order string) (string, bool, error) {
+	descending := strings.HasPrefix(order, "-")
+	field := strings.TrimPrefix(order, "-")
+
+	switch field {
+	case "":
+		return SortID, descending, nil
+	case SortID, SortName, SortPrice, SortLastChecked, SortPriceChange:
+		return field, descending, nil
+	default:
+		return "", false, fmt.Errorf(
+			"unknown sort order '%s', use %s, %s, %s, %s or %s with an optional '-' in front",
+			order, SortID, SortName, SortPrice, SortLastChecked, SortPriceChange,
+		)
+	}
+}
+
+/*
+lastPrice returns the last price of the watcher as a number, converted to the currency when a rates table is given.
+*/
+func lastPrice(table *rates.Table, watcher *model.Watcher, currency string) (*float64, error) {
+	if watcher.LastPrice == nil {
+		return nil, nil
+	}
+
+	value := watcher.LastPrice.Value
+	if table != nil {
+		var err error
+		if value, err = table.Convert(value, currency, watcher.LastPrice.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	price := value.Float64()
+	return &price, nil
+}
+
+/*
+priceChange returns the change in percent of the last price of the watcher from the price before it in the same
+currency, or nil when the watcher has no such prices.
+*/
+func priceChange(s store.Store, id int) (*float64, error) {
+	history, err := s.History(id, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) < 2 {
+		return nil, nil
+	}
+
+	last := history[len(history)-1].Value
+	previous := history[len(history)-2].Value
+	if !last.SameCurrency(previous) {
+		return nil, nil
+	}
+
+	change := -percentDrop(previous, last)
+	return &change, nil
+}
+
+/*
+encodeCursor returns the cursor for the page after the watcher with the given sort key.
+*/
+func encodeCursor(order string, key sortKey) string {
+	v, _ := json.Marshal(cursor{Sort: order, Key: key})
+	return base64.RawURLEncoding.EncodeToString(v)
+}
+
+/*
+decodeCursor returns the cursor, it fails with ErrInvalidCursor when it can not be read or was made for another sort
+order.
+*/
+func decodeCursor(value, order string) (*cursor, error) {
+	v, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &cursor{}
+	if err := json.Unmarshal(v, c); err != nil || c.Sort != order {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
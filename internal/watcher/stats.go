@@ -0,0 +1,159 @@
+package watcher
+
+import (
+	"math"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/money"
+)
+
+/*
+Downsample groups the prices, ordered by timestamp, into buckets of the given size. The buckets start at a multiple of
+the size since the zero time, so daily buckets start at midnight UTC and weekly buckets on Monday. Only the prices in the
+currency of the last price are used and buckets without prices are left out.
+*/
+func Downsample(prices []model.Price, size time.Duration) []model.PriceBucket {
+	buckets := []model.PriceBucket{}
+	prices = inCurrencyOfLast(prices)
+
+	var values []money.Money
+	for i, price := range prices {
+		start := price.Timestamp.UTC().Truncate(size)
+
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			buckets = append(buckets, model.PriceBucket{
+				Start: start,
+				End:   start.Add(size),
+				Min:   price.Value,
+				Max:   price.Value,
+			})
+			values = nil
+		}
+
+		bucket := &buckets[len(buckets)-1]
+		values = append(values, price.Value)
+
+		bucket.Count++
+		bucket.Last = price.Value
+		if price.Value.Less(bucket.Min) {
+			bucket.Min = price.Value
+		}
+		if bucket.Max.Less(price.Value) {
+			bucket.Max = price.Value
+		}
+
+		if i == len(prices)-1 || !prices[i+1].Timestamp.UTC().Truncate(size).Equal(start) {
+			bucket.Average = average(values)
+		}
+	}
+
+	return buckets
+}
+
+/*
+Statistics returns the statistics of the full price history ordered by timestamp with the averages for the 30 and 90
+days before now, the change is computed for the prices of the requested range, rounded to two decimals. Only the prices
+in the currency of the last price are used.
+*/
+func Statistics(history, inRange []model.Price, now time.Time) model.PriceStats {
+	stats := model.PriceStats{}
+
+	history = inCurrencyOfLast(history)
+	if len(history) == 0 {
+		return stats
+	}
+
+	current := history[len(history)-1]
+	stats.Current = &current
+
+	for i := range history {
+		if stats.Low == nil || history[i].Value.Less(stats.Low.Value) {
+			low := history[i]
+			stats.Low = &low
+		}
+		if stats.High == nil || stats.High.Value.Less(history[i].Value) {
+			high := history[i]
+			stats.High = &high
+		}
+	}
+
+	stats.Average30Days = averageSince(history, now.AddDate(0, 0, -30))
+	stats.Average90Days = averageSince(history, now.AddDate(0, 0, -90))
+
+	if inRange = inCurrency(inRange, current.Value); len(inRange) > 0 {
+		change := math.Round(-percentDrop(inRange[0].Value, inRange[len(inRange)-1].Value)*100) / 100
+		stats.Change = &change
+	}
+
+	return stats
+}
+
+/*
+inCurrencyOfLast returns the prices in the currency of the last price.
+*/
+func inCurrencyOfLast(prices []model.Price) []model.Price {
+	if len(prices) == 0 {
+		return prices
+	}
+
+	return inCurrency(prices, prices[len(prices)-1].Value)
+}
+
+/*
+inCurrency returns the prices in the currency of the given amount.
+*/
+func inCurrency(prices []model.Price, amount money.Money) []model.Price {
+	same := make([]model.Price, 0, len(prices))
+	for _, price := range prices {
+		if price.Value.SameCurrency(amount) {
+			same = append(same, price)
+		}
+	}
+
+	return same
+}
+
+/*
+averageSince returns the average of the prices since the given time, or nil when there are none.
+*/
+func averageSince(prices []model.Price, since time.Time) *money.Money {
+	var values []money.Money
+	for _, price := range prices {
+		if !price.Timestamp.Before(since) {
+			values = append(values, price.Value)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	avg := average(values)
+	return &avg
+}
+
+/*
+average returns the average of the values in the same currency, rounded half away from zero to the minor unit.
+*/
+func average(values []money.Money) money.Money {
+	var sum int64
+	for _, value := range values {
+		sum += value.Amount
+	}
+
+	n := int64(len(values))
+	amount, remainder := sum/n, sum%n
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if 2*remainder >= n {
+		if sum < 0 {
+			amount--
+		} else {
+			amount++
+		}
+	}
+
+	return money.New(amount, values[0].Currency)
+}
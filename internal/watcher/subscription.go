@@ -0,0 +1,219 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/laetificat/pricewatcher/internal/events"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+)
+
+// ErrSharedWatcher is returned when a user changes the URL or domain of a watcher that other users are subscribed to.
+var ErrSharedWatcher = fmt.Errorf(
+	"the url and domain of a watcher that other users are subscribed to can only be changed by an admin",
+)
+
+/*
+IsSubscribed checks if the user with the given name is subscribed to the watcher.
+*/
+func IsSubscribed(watcher *model.Watcher, user string) bool {
+	return FindSubscription(watcher, user) != nil
+}
+
+/*
+FindSubscription returns the subscription of the user with the given name to the watcher, or nil when the user is not
+subscribed to it. Changes to the subscription change the watcher.
+*/
+func FindSubscription(watcher *model.Watcher, user string) *model.Subscription {
+	for i := range watcher.Subscribers {
+		if watcher.Subscribers[i].User == user {
+			return &watcher.Subscribers[i]
+		}
+	}
+
+	return nil
+}
+
+/*
+Personalize changes the watcher into the watcher as the user with the given name sees it, the tags, alert rules and
+alerts of the subscription of the user replace those of the watcher and its name replaces the name of the watcher when
+it is set. A watcher the user is not subscribed to is not changed.
+*/
+func Personalize(watcher *model.Watcher, user string) {
+	subscription := FindSubscription(watcher, user)
+	if subscription == nil {
+		return
+	}
+
+	if subscription.Name != "" {
+		watcher.Name = subscription.Name
+	}
+	watcher.Tags = subscription.Tags
+	watcher.AlertRules = subscription.AlertRules
+	watcher.Alerts = subscription.Alerts
+}
+
+/*
+CreateFor creates the watcher for the user with the given name, the name, tags and alert rules of the watcher are kept
+in the subscription of the user. The user is subscribed to the existing watcher of the URL with them instead when the
+URL is already watched. Returns the stored watcher and if it is new, fails with ErrDuplicateURL when the user already
+watches the URL.
+*/
+func CreateFor(s store.Store, user string, newWatcher *model.Watcher) (*model.Watcher, bool, error) {
+	subscription := model.Subscription{
+		User:       user,
+		Name:       newWatcher.Name,
+		Tags:       newWatcher.Tags,
+		AlertRules: newWatcher.AlertRules,
+	}
+
+	newWatcher.Name, newWatcher.Tags, newWatcher.AlertRules = "", nil, nil
+	newWatcher.Subscribers = []model.Subscription{subscription}
+
+	err := Create(s, newWatcher)
+	if err == ErrDuplicateURL {
+		shared, err := Subscribe(s, newWatcher.URL, subscription)
+		return shared, false, err
+	}
+
+	return newWatcher, err == nil, err
+}
+
+/*
+Subscribe subscribes the user of the subscription to the watcher of the URL with the name, tags and alert rules of the
+subscription and returns the watcher, so a URL that is already watched is shared instead of checked twice. It fails
+with ErrNotFound when no watcher exists for the URL and with ErrDuplicateURL when the user is already subscribed to it.
+*/
+func Subscribe(s store.Store, url string, subscription model.Subscription) (*model.Watcher, error) {
+	if err := normalizeSubscription(&subscription); err != nil {
+		return nil, err
+	}
+
+	watchers, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range watchers {
+		if existing.URL != url {
+			continue
+		}
+
+		var subscribed *model.Watcher
+		err := s.Update(existing.ID, func(w *model.Watcher) error {
+			if IsSubscribed(w, subscription.User) {
+				return ErrDuplicateURL
+			}
+
+			w.Subscribers = addSubscription(w.Subscribers, subscription)
+			subscribed = w
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		events.Publish(events.WatcherUpdated, subscribed.SubscriberNames(), *subscribed)
+
+		return subscribed, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+/*
+Unsubscribe unsubscribes the user with the given name from the watcher with the given ID, the watcher and its price
+history are removed when it was the last subscriber. It fails with ErrNotFound when the user is not subscribed to the
+watcher.
+*/
+func Unsubscribe(s store.Store, id int, user string) error {
+	var remaining int
+
+	err := s.Update(id, func(w *model.Watcher) error {
+		if !IsSubscribed(w, user) {
+			return ErrNotFound
+		}
+
+		kept := []model.Subscription{}
+		for _, subscription := range w.Subscribers {
+			if subscription.User != user {
+				kept = append(kept, subscription)
+			}
+		}
+
+		w.Subscribers = kept
+		remaining = len(kept)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if remaining == 0 {
+		return remove(s, id, []string{user})
+	}
+
+	return nil
+}
+
+/*
+UnsubscribeAll unsubscribes the user with the given name from all the watchers, returns the amount of watchers the user
+was subscribed to.
+*/
+func UnsubscribeAll(s store.Store, user string) (int, error) {
+	watchers, _, err := List(s, Query{Subscriber: user})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, subscribed := range watchers {
+		if err := Unsubscribe(s, subscribed.ID, user); err != nil && err != ErrNotFound {
+			return i, err
+		}
+	}
+
+	return len(watchers), nil
+}
+
+/*
+normalizeSubscription checks the alert rules of the subscription and normalizes its tags.
+*/
+func normalizeSubscription(subscription *model.Subscription) error {
+	for _, rule := range subscription.AlertRules {
+		if err := ValidateAlertRule(rule); err != nil {
+			return err
+		}
+	}
+
+	tags, err := NormalizeTags(subscription.Tags)
+	if err != nil {
+		return err
+	}
+	subscription.Tags = tags
+
+	if subscription.Alerts == nil {
+		subscription.Alerts = []model.Alert{}
+	}
+
+	return nil
+}
+
+/*
+addSubscription returns the subscriptions with the subscription added, sorted by user. An existing subscription of the
+user is kept.
+*/
+func addSubscription(subscriptions []model.Subscription, subscription model.Subscription) []model.Subscription {
+	for _, existing := range subscriptions {
+		if existing.User == subscription.User {
+			return subscriptions
+		}
+	}
+
+	subscriptions = append(subscriptions, subscription)
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].User < subscriptions[j].User
+	})
+
+	return subscriptions
+}
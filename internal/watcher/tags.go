@@ -0,0 +1,236 @@
+package watcher
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/laetificat/pricewatcher/internal/events"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+)
+
+// tagPattern are the valid tags and collection names, lowercase letters, digits, dashes and underscores.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// ErrCollectionNotFound is returned when no collection exists with the given name.
+var ErrCollectionNotFound = fmt.Errorf("collection not found")
+
+// TagCount is a tag with the amount of watchers that have it.
+type TagCount struct {
+	Tag      string
+	Watchers int
+}
+
+/*
+NormalizeTags returns the tags in lowercase without spaces around them, sorted and without duplicates. Tags can only
+have letters, digits, dashes and underscores, like "office-chairs" or "black_friday".
+*/
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf(
+				"tag '%s' can only have letters, digits, dashes and underscores and up to 50 characters",
+				tag,
+			)
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+/*
+AddTags adds the tags to the watcher with the given ID and returns the changed watcher, tags it already has are ignored.
+The tags are added to the subscription of the user with the given name, or to the watcher itself when it is empty.
+*/
+func AddTags(s store.Store, id int, user string, tags []string) (*model.Watcher, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return changeTags(s, id, user, func(current []string) []string {
+		return append(current, tags...)
+	})
+}
+
+/*
+RemoveTags removes the tags from the watcher with the given ID and returns the changed watcher, tags it does not have
+are ignored. The tags are removed from the subscription of the user with the given name, or from the watcher itself
+when it is empty.
+*/
+func RemoveTags(s store.Store, id int, user string, tags []string) (*model.Watcher, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return changeTags(s, id, user, func(current []string) []string {
+		kept := []string{}
+		for _, tag := range current {
+			if !containsTag(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+
+		return kept
+	})
+}
+
+/*
+Tags returns all the tags of the watchers with the amount of watchers that have them, ordered by tag. Only the watchers
+of the given subscriber are counted with the tags of its subscriptions, or all the watchers when it is empty.
+*/
+func Tags(s store.Store, subscriber string) ([]TagCount, error) {
+	watchers, _, err := List(s, Query{Subscriber: subscriber})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, watcher := range watchers {
+		for _, tag := range watcher.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Watchers: count})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return tags, nil
+}
+
+/*
+SaveCollection validates the collection and stores it, a collection with the same name is replaced. Returns if the
+collection is new.
+*/
+func SaveCollection(s store.Store, collection *model.Collection) (bool, error) {
+	collection.Name = strings.ToLower(strings.TrimSpace(collection.Name))
+	if err := ValidateCollectionName(collection.Name); err != nil {
+		return false, err
+	}
+
+	var err error
+	if collection.Tags, err = NormalizeTags(collection.Tags); err != nil {
+		return false, err
+	}
+
+	_, err = s.Collection(collection.Name)
+	if err != nil && err != store.ErrNotFound {
+		return false, err
+	}
+	created := err == store.ErrNotFound
+
+	return created, s.SaveCollection(collection)
+}
+
+/*
+ValidateCollectionName checks if the name can be used for a collection, names follow the same rules as tags.
+*/
+func ValidateCollectionName(name string) error {
+	if !tagPattern.MatchString(strings.ToLower(strings.TrimSpace(name))) {
+		return fmt.Errorf(
+			"collection name '%s' can only have letters, digits, dashes and underscores and up to 50 characters",
+			name,
+		)
+	}
+
+	return nil
+}
+
+/*
+Collections returns all the collections ordered by name.
+*/
+func Collections(s store.Store) ([]model.Collection, error) {
+	return s.Collections()
+}
+
+/*
+Collection returns the collection with the given name.
+*/
+func Collection(s store.Store, name string) (*model.Collection, error) {
+	collection, err := s.Collection(strings.ToLower(name))
+	if err == store.ErrNotFound {
+		return nil, ErrCollectionNotFound
+	}
+
+	return collection, err
+}
+
+/*
+RemoveCollection removes the collection with the given name, the watchers and their tags are kept.
+*/
+func RemoveCollection(s store.Store, name string) error {
+	err := s.RemoveCollection(strings.ToLower(name))
+	if err == store.ErrNotFound {
+		return ErrCollectionNotFound
+	}
+
+	return err
+}
+
+/*
+changeTags replaces the tags of the subscription of the user, or of the watcher when the user is empty, with the tags
+that change returns for its current tags. It fails with ErrNotFound when the user is not subscribed to the watcher.
+*/
+func changeTags(s store.Store, id int, user string, change func(current []string) []string) (*model.Watcher, error) {
+	var changed *model.Watcher
+
+	err := s.Update(id, func(w *model.Watcher) error {
+		current := &w.Tags
+		if user != "" {
+			subscription := FindSubscription(w, user)
+			if subscription == nil {
+				return ErrNotFound
+			}
+			current = &subscription.Tags
+		}
+
+		tags, err := NormalizeTags(change(*current))
+		if err != nil {
+			return err
+		}
+
+		*current = tags
+		changed = w
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.Publish(events.WatcherUpdated, changed.SubscriberNames(), *changed)
+
+	return changed, nil
+}
+
+/*
+containsTag checks if the tag is one of the tags.
+*/
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
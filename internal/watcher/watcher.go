@@ -1,307 +1,480 @@
 package watcher
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/fatih/structs"
+	"github.com/laetificat/pricewatcher/internal/events"
+	"github.com/laetificat/pricewatcher/internal/helper"
 	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/notifier"
 	"github.com/laetificat/pricewatcher/internal/queue"
+	"github.com/laetificat/pricewatcher/internal/store"
 	"github.com/laetificat/slogger/pkg/slogger"
 	"github.com/spf13/viper"
-
-	bolt "go.etcd.io/bbolt"
 )
 
-// SupportedDomains is the list of supported domains.
-var SupportedDomains = []string{
-	"bol.com",
-	"ebay.nl",
-	"coolblue.nl",
+// ErrNotFound is returned when no watcher exists with the given ID.
+var ErrNotFound = store.ErrNotFound
+
+// ErrDuplicateURL is returned when another watcher already watches the URL of a new or changed watcher, the store
+// checks the URL in the transaction that stores the watcher.
+var ErrDuplicateURL = store.ErrDuplicateURL
+
+// triggered are the alerts that triggered for the subscriber, or for the rules of the watcher itself when the
+// subscriber is empty.
+type triggered struct {
+	subscriber string
+	alerts     []model.Alert
+}
+
+// Changes are the changes Edit and EditSubscription make to a watcher, nil fields are not changed.
+type Changes struct {
+	Name       *string
+	URL        *string
+	Domain     *string
+	AlertRules *[]model.AlertRule
+	Tags       *[]string
 }
 
 /*
-Add registers a new watcher object in the database with the given domain and url.
+Add registers a new watcher object in the store with the given domain, url and alert rules.
 */
-func Add(domain, url string) error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
-	if err != nil {
-		return err
+func Add(s store.Store, domain, url string, alertRules []model.AlertRule) error {
+	return Create(s, &model.Watcher{URL: url, Domain: domain, AlertRules: alertRules})
+}
+
+/*
+Create stores the given watcher as a new watcher and sets its ID, it fails with ErrDuplicateURL when a watcher already
+exists for its URL. Use Subscribe to share the existing watcher instead.
+*/
+func Create(s store.Store, watcher *model.Watcher) error {
+	for _, rule := range watcher.AlertRules {
+		if err := ValidateAlertRule(rule); err != nil {
+			return err
+		}
 	}
-	defer db.Close()
 
-	watcher := model.Watcher{
-		URL:          url,
-		Domain:       domain,
-		IsChecking:   false,
-		PriceHistory: []model.Price{},
+	tags, err := NormalizeTags(watcher.Tags)
+	if err != nil {
+		return err
 	}
+	watcher.Tags = tags
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, inErr := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if inErr != nil {
-			return inErr
+	subscriptions := []model.Subscription{}
+	for _, subscription := range watcher.Subscribers {
+		if err := normalizeSubscription(&subscription); err != nil {
+			return err
 		}
 
-		id, _ := b.NextSequence()
-		watcher.ID = int(id)
+		subscriptions = addSubscription(subscriptions, subscription)
+	}
+	watcher.Subscribers = subscriptions
 
-		w, inErr := json.Marshal(watcher)
-		if inErr != nil {
-			return inErr
-		}
+	watcher.CustomName = watcher.Name != ""
+	watcher.IsChecking = false
+	if watcher.Alerts == nil {
+		watcher.Alerts = []model.Alert{}
+	}
 
-		return b.Put(itob(watcher.ID), w)
-	})
+	if err := s.Add(watcher); err != nil {
+		return err
+	}
+
+	events.Publish(events.WatcherCreated, watcher.SubscriberNames(), *watcher)
 
-	return err
+	return nil
 }
 
 /*
-List returns all watcher models from the database, filters items based on a map.
+Edit makes the given changes to the watcher with the given ID and returns the changed watcher, the price history and
+the triggered alerts are kept. A changed name is kept when the price is updated, an empty name is replaced by the name
+on the product page again. It fails with ErrDuplicateURL when the URL is changed to the URL of another watcher.
+*/
+func Edit(s store.Store, id int, changes Changes) (*model.Watcher, error) {
+	return edit(s, id, "", true, changes)
+}
 
-Example:
-List(map[string]string{"domain": "bol.com"})
+/*
+EditSubscription makes the given changes for the user with the given name and returns the changed watcher: the name,
+alert rules and tags are changed in the subscription of the user, the URL and domain are changed for all the
+subscribers. Only admins and the only subscriber can change the URL and domain, it fails with ErrSharedWatcher for
+other users and with ErrNotFound when the user is not subscribed to the watcher.
 */
-func List(keys map[string]string) ([]model.Watcher, error) {
-	watcherList := []model.Watcher{}
+func EditSubscription(s store.Store, id int, user string, admin bool, changes Changes) (*model.Watcher, error) {
+	return edit(s, id, user, admin, changes)
+}
 
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
-	if err != nil {
-		return watcherList, err
+/*
+edit makes the changes to the watcher with the given ID, the name, alert rules and tags are changed in the
+subscription of the user or for the watcher itself when the user is empty.
+*/
+func edit(s store.Store, id int, user string, admin bool, changes Changes) (*model.Watcher, error) {
+	if changes.AlertRules != nil {
+		for _, rule := range *changes.AlertRules {
+			if err := ValidateAlertRule(rule); err != nil {
+				return nil, err
+			}
+		}
 	}
-	defer db.Close()
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, inErr := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if inErr != nil {
-			return inErr
+	if changes.Tags != nil {
+		tags, err := NormalizeTags(*changes.Tags)
+		if err != nil {
+			return nil, err
 		}
+		changes.Tags = &tags
+	}
 
-		inErr = b.ForEach(func(bk, bv []byte) error {
-			watcher := model.Watcher{}
-			inInErr := json.Unmarshal(bv, &watcher)
-			if inInErr != nil {
-				return inInErr
-			}
+	var edited *model.Watcher
+	err := s.Update(id, func(w *model.Watcher) error {
+		urlChanged := changes.URL != nil && *changes.URL != w.URL
+		domainChanged := changes.Domain != nil && *changes.Domain != w.Domain
+		if (urlChanged || domainChanged) && !admin && len(w.Subscribers) > 1 {
+			return ErrSharedWatcher
+		}
 
-			watcherStruct := structs.Map(watcher)
-
-			if len(keys) == 0 {
-				watcherList = append(watcherList, watcher)
-			} else {
-				for k, v := range keys {
-					if val, ok := watcherStruct[k]; ok {
-						if val == v {
-							watcherList = append(watcherList, watcher)
-						}
-					}
-				}
-			}
+		if err := changeSettings(w, user, changes); err != nil {
+			return err
+		}
 
-			return nil
-		})
+		if changes.URL != nil {
+			w.URL = *changes.URL
+		}
+		if changes.Domain != nil {
+			w.Domain = *changes.Domain
+		}
 
-		return inErr
+		edited = w
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.Publish(events.WatcherUpdated, edited.SubscriberNames(), *edited)
 
-	return watcherList, err
+	return edited, nil
 }
 
 /*
-Remove removes a watcher model from the database based on ID.
+changeSettings changes the name, alert rules and tags in the subscription of the user, or of the watcher itself when
+the user is empty. A name of a subscription is only shown to its user, so it does not make the name of the watcher
+custom.
 */
-func Remove(id int) error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if err != nil {
-			return err
+func changeSettings(w *model.Watcher, user string, changes Changes) error {
+	if user == "" {
+		if changes.Name != nil {
+			w.Name = *changes.Name
+			w.CustomName = w.Name != ""
 		}
-		c := b.Cursor()
-
-		for k, _ := c.Seek(itob(id)); k != nil && !bytes.Equal(k, itob(id)); k, _ = c.Next() {
-			if err := c.Delete(); err != nil {
-				return err
-			}
+		if changes.AlertRules != nil {
+			w.AlertRules = *changes.AlertRules
+		}
+		if changes.Tags != nil {
+			w.Tags = *changes.Tags
 		}
 
 		return nil
-	})
+	}
+
+	subscription := FindSubscription(w, user)
+	if subscription == nil {
+		return ErrNotFound
+	}
+
+	if changes.Name != nil {
+		subscription.Name = *changes.Name
+	}
+	if changes.AlertRules != nil {
+		subscription.AlertRules = *changes.AlertRules
+	}
+	if changes.Tags != nil {
+		subscription.Tags = *changes.Tags
+	}
+
+	return nil
 }
 
 /*
-RemoveAll removes all the registered watchers.
+List returns the watchers from the store that match the query without their price history, and the cursor of the next
+page when the query has a limit and there are more watchers.
+
+Example:
+List(s, Query{Domain: "bol.com", Sort: "-price", Limit: 50})
 */
-func RemoveAll() error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
+func List(s store.Store, query Query) ([]model.Watcher, string, error) {
+	watchers, err := s.List()
 	if err != nil {
-		return err
+		return []model.Watcher{}, "", err
 	}
-	defer db.Close()
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("watchers"))
+	return find(s, watchers, query)
+}
+
+/*
+Get returns a single watcher model from the store based on ID, without its price history.
+*/
+func Get(s store.Store, id int) (*model.Watcher, error) {
+	return s.Get(id)
+}
+
+/*
+History returns the prices of the watcher with the given ID from the given time up to and including the given time,
+ordered by timestamp. A zero time leaves that side of the range open.
+*/
+func History(s store.Store, id int, from, to time.Time) ([]model.Price, error) {
+	return s.History(id, from, to)
+}
+
+/*
+LoadHistories fills the price history of the given watchers.
+*/
+func LoadHistories(s store.Store, watchers []model.Watcher) error {
+	for i := range watchers {
+		prices, err := s.History(watchers[i].ID, time.Time{}, time.Time{})
 		if err != nil {
 			return err
 		}
 
-		c := b.Cursor()
+		watchers[i].PriceHistory = prices
+	}
 
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			err := b.Delete(k)
-			if err != nil {
-				return err
-			}
-		}
+	return nil
+}
 
-		return nil
-	})
+/*
+Remove removes a watcher model from the store based on ID.
+*/
+func Remove(s store.Store, id int) error {
+	found, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return remove(s, id, found.SubscriberNames())
 }
 
 /*
-Run adds a single watcher from the database to the queue as a job based on ID.
+RemoveAll removes all the registered watchers.
 */
-func Run(id int) error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
+func RemoveAll(s store.Store) error {
+	watchers, err := s.List()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if err != nil {
-			return err
-		}
+	subscribers := map[int][]string{}
+	for i := range watchers {
+		subscribers[watchers[i].ID] = watchers[i].SubscriberNames()
+	}
 
-		c := b.Cursor()
-		k, v := c.Seek(itob(id))
+	ids, err := s.RemoveAll()
+	if err != nil {
+		return err
+	}
 
-		if k == nil || !bytes.Equal(k, itob(id)) {
-			return fmt.Errorf("key not found")
-		}
+	for _, id := range ids {
+		publishRemoved(id, subscribers[id])
+	}
 
-		client := &http.Client{}
-		return addToQueue(client, v)
-	})
+	return nil
 }
 
 /*
-RunAll adds all the watchers to the queue as a job from the database.
+remove removes the watcher with the given ID and publishes the event for the given subscribers.
 */
-func RunAll() error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
-	if err != nil {
+func remove(s store.Store, id int, subscribers []string) error {
+	if err := s.Remove(id); err != nil {
 		return err
 	}
-	defer db.Close()
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if err != nil {
-			return err
-		}
+	publishRemoved(id, subscribers)
 
-		client := &http.Client{}
+	return nil
+}
 
-		err = b.ForEach(func(k, v []byte) error {
-			return addToQueue(client, v)
-		})
+/*
+publishRemoved publishes the event for a removed watcher.
+*/
+func publishRemoved(id int, subscribers []string) {
+	events.Publish(events.WatcherRemoved, subscribers, struct {
+		ID int `json:"id"`
+	}{id})
+}
 
+/*
+Run adds a single watcher from the store to the queue as a job based on ID.
+*/
+func Run(s store.Store, id int) error {
+	watcher, err := s.Get(id)
+	if err != nil {
 		return err
-	})
+	}
+
+	return addToQueue(watcher)
 }
 
 /*
-Update adds the given price from the update model to the watcher model that is found with the update model id.
+RunAll adds all the watchers from the store that match the query to the queue as a job, an empty query matches all the
+watchers.
 */
-func Update(updateModel *model.Update) error {
-	db, err := bolt.Open(viper.GetString("database_file"), 0600, nil)
+func RunAll(s store.Store, query Query) error {
+	watchers, _, err := List(s, query)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("watchers"))
-		if err != nil {
+	for i := range watchers {
+		if err := addToQueue(&watchers[i]); err != nil {
 			return err
 		}
+	}
 
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if !bytes.Equal(k, itob(updateModel.ID)) {
-				continue
-			}
+	return nil
+}
 
-			bWatcher := model.Watcher{}
-			if err := json.Unmarshal(v, &bWatcher); err != nil {
-				return err
-			}
+/*
+Update adds the given price from the update model to the price history of the watcher that is found with the update
+model id, a price without timestamp gets the current time. The name on the product page is only used when the watcher
+has no custom name. An update for a watcher that no longer exists is ignored.
+*/
+func Update(s store.Store, updateModel *model.Update) error {
+	if updateModel.Price.Timestamp.IsZero() {
+		updateModel.Price.Timestamp = time.Now()
+	}
 
-			bWatcher.Name = updateModel.Name
-			bWatcher.LastChecked = updateModel.Price.Timestamp
-			bWatcher.PriceHistory = append(bWatcher.PriceHistory, updateModel.Price)
+	var updatedWatcher *model.Watcher
+	var previousPrice *model.Price
+	var triggeredAlerts []triggered
 
-			w, err := json.Marshal(bWatcher)
-			if err != nil {
-				return err
-			}
+	err := s.AppendPrice(updateModel.ID, updateModel.Price, func(w *model.Watcher) error {
+		previousPrice = w.LastPrice
+		triggeredAlerts = triggerAlerts(w, updateModel.Price)
 
-			return b.Put(k, w)
+		if !w.CustomName && updateModel.Name != "" {
+			w.Name = updateModel.Name
+		}
+		if updateModel.Availability != "" {
+			w.Availability = updateModel.Availability
 		}
+		if updateModel.GTIN != "" {
+			w.GTIN = updateModel.GTIN
+		}
+		w.LastChecked = updateModel.Price.Timestamp
+		trackPrice(w, updateModel.Price)
 
+		updatedWatcher = w
 		return nil
 	})
-}
-
-func addToQueue(client *http.Client, v []byte) error {
-	watcher := model.Watcher{}
-	err := json.Unmarshal(v, &watcher)
+	if err == store.ErrNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if time.Since(watcher.LastChecked).Hours() <= viper.GetFloat64("watcher.check_interval") {
-		return nil
+	events.Publish(events.PriceUpdated, updatedWatcher.SubscriberNames(), updateModel)
+	notifyPriceEvents(updatedWatcher, previousPrice, updateModel.Price)
+	notifyAlerts(updatedWatcher, triggeredAlerts)
+
+	return nil
+}
+
+/*
+triggerAlerts evaluates the alert rules of the watcher and of its subscriptions for the new price and adds the
+triggered alerts to the watcher and the subscriptions, it is called before the new price is tracked.
+*/
+func triggerAlerts(w *model.Watcher, price model.Price) []triggered {
+	all := []triggered{{alerts: evaluateAlerts(w, w.AlertRules, price)}}
+	w.Alerts = append(w.Alerts, all[0].alerts...)
+
+	for i := range w.Subscribers {
+		subscription := &w.Subscribers[i]
+
+		alerts := evaluateAlerts(w, subscription.AlertRules, price)
+		subscription.Alerts = append(subscription.Alerts, alerts...)
+		all = append(all, triggered{subscriber: subscription.User, alerts: alerts})
 	}
 
-	slogger.Debug(fmt.Sprintf("Adding item to queue '%s'", watcher.Domain))
-	res, err := client.Post(
-		viper.GetString("webserver.address")+"/queues/"+queue.GetNameForDomain(watcher.Domain)+"/add",
-		"application/json",
-		bytes.NewBuffer(v),
-	)
-	if err != nil {
-		return err
+	return all
+}
+
+/*
+trackPrice sets the price as the last price of the watcher and as the lowest price when it is lower than the lowest
+price in the same currency. The lowest price starts over when the currency changes.
+*/
+func trackPrice(w *model.Watcher, price model.Price) {
+	if w.LowestPrice == nil || !w.LowestPrice.Value.SameCurrency(price.Value) || price.Value.Less(w.LowestPrice.Value) {
+		lowest := price
+		w.LowestPrice = &lowest
 	}
 
-	defer res.Body.Close()
+	last := price
+	w.LastPrice = &last
+}
 
-	if res.StatusCode > 200 {
-		return fmt.Errorf("adding job failed, stats code %s", strconv.Itoa(res.StatusCode))
+/*
+notifyPriceEvents dispatches the price events for a new price to the notifiers, failures are logged by the notifiers and
+never fail the price update.
+*/
+func notifyPriceEvents(watcher *model.Watcher, previous *model.Price, current model.Price) {
+	notifier.Dispatch(&notifier.Event{
+		Type:     notifier.EventPriceUpdated,
+		Watcher:  watcher,
+		Previous: previous,
+		Current:  current,
+	})
+
+	if previous != nil && previous.Value.SameCurrency(current.Value) && current.Value.Less(previous.Value) {
+		slogger.Debug(fmt.Sprintf("Price dropped for watcher %d, sending notifications", watcher.ID))
+		notifier.Dispatch(&notifier.Event{
+			Type:     notifier.EventPriceDropped,
+			Watcher:  watcher,
+			Previous: previous,
+			Current:  current,
+		})
 	}
+}
 
-	return nil
+/*
+notifyAlerts dispatches an event to the notifiers for every triggered alert, the alerts of a subscription are published
+with the watcher as its user sees it and only for that user.
+*/
+func notifyAlerts(watcher *model.Watcher, triggeredAlerts []triggered) {
+	for _, t := range triggeredAlerts {
+		shown, subscribers := watcher, watcher.SubscriberNames()
+		if t.subscriber != "" {
+			personal := *watcher
+			Personalize(&personal, t.subscriber)
+			shown, subscribers = &personal, []string{t.subscriber}
+		}
+
+		for i := range t.alerts {
+			slogger.Info(fmt.Sprintf("Alert triggered for watcher %d: %s", watcher.ID, t.alerts[i].Message))
+			events.Publish(events.AlertTriggered, subscribers, struct {
+				WatcherID int         `json:"watcher_id"`
+				Alert     model.Alert `json:"alert"`
+			}{watcher.ID, t.alerts[i]})
+			notifier.Dispatch(&notifier.Event{
+				Type:    notifier.EventAlertTriggered,
+				Watcher: shown,
+				Current: t.alerts[i].Price,
+				Alert:   &t.alerts[i],
+			})
+		}
+	}
 }
 
 /*
-itob transforms an int to a binary representation for BoltDB
+addToQueue adds the watcher as a job to the queue of its domain, unless it was checked within the check interval. The
+queues are opened by the webserver, so only the webserver can run watchers.
 */
-func itob(v int) []byte {
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, uint64(v))
-	return b
+func addToQueue(watcher *model.Watcher) error {
+	if time.Since(watcher.LastChecked).Hours() <= viper.GetFloat64("watcher.check_interval") {
+		return nil
+	}
+
+	slogger.Debug(fmt.Sprintf("Adding item to queue '%s'", watcher.Domain))
+	return queue.Add(helper.GetQueueName(watcher.Domain), watcher)
 }
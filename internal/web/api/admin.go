@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/account"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+)
+
+/*
+RegisterAdminHandler registers the admin handler, its routes need the admin.token from the config or the token of an
+admin user as a bearer token.
+*/
+func RegisterAdminHandler(router *httprouter.Router, s store.Store) {
+	h := &adminHandler{store: s}
+
+	router.GET("/admin/backup", h.Backup)
+}
+
+// adminHandler handles the admin routes with the database in the store.
+type adminHandler struct {
+	store store.Store
+}
+
+/*
+Backup streams a consistent snapshot of the watcher database, the watchers can be changed while it is streamed.
+*/
+func (h *adminHandler) Backup(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !isAdmin(h.store, r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pricewatcher"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	name := filepath.Base(viper.GetString("database_file"))
+	extension := filepath.Ext(name)
+	name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, extension), time.Now().Format("20060102150405"), extension)
+
+	header := w.Header()
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+
+	written, err := h.store.Backup(w)
+	if err != nil {
+		// Nothing is written when the snapshot can not be started, otherwise the response is cut off.
+		if written == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		slogger.Error(err.Error())
+		return
+	}
+
+	slogger.Info(fmt.Sprintf("Streamed a backup of %d bytes", written))
+}
+
+/*
+isAdmin checks if the request has the admin.token from the config or the token of an admin user as bearer token. Unlike
+the watcher routes the admin routes are closed when there are no users.
+*/
+func isAdmin(s store.Store, r *http.Request) bool {
+	if hasAdminToken(r) {
+		return true
+	}
+
+	user, err := account.Authenticate(s, bearerToken(r))
+	if err != nil && err != account.ErrUnauthorized {
+		slogger.Error(err.Error())
+	}
+
+	return err == nil && user.Admin
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/account"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
+)
+
+/*
+requestUser returns the user of the bearer token of the request, or account.ErrUnauthorized. The admin.token from the
+config is an admin without a name. As long as there are no users everybody is an admin without a name, so an instance
+without accounts works like before.
+*/
+func requestUser(s store.Store, r *http.Request) (*model.User, error) {
+	if hasAdminToken(r) {
+		return &model.User{Admin: true}, nil
+	}
+
+	enabled, err := account.Enabled(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		return &model.User{Admin: true}, nil
+	}
+
+	return account.Authenticate(s, bearerToken(r))
+}
+
+/*
+authorize returns the user of the request for the v1 routes, or writes the error response and returns false.
+*/
+func authorize(s store.Store, w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, err := requestUser(s, r)
+	if err != nil {
+		if err == account.ErrUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pricewatcher"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return nil, false
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return nil, false
+	}
+
+	return user, true
+}
+
+/*
+authorizeV2 returns the user of the request for the v2 routes, or writes the error response and returns false.
+*/
+func authorizeV2(s store.Store, w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, err := requestUser(s, r)
+	if err != nil {
+		if err == account.ErrUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pricewatcher"`)
+			writeError(w, http.StatusUnauthorized, errorUnauthorized, "a valid bearer token is required", "")
+			return nil, false
+		}
+
+		writeInternalError(w, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+/*
+canSee checks if the user can see and change the watcher, admins see all the watchers and other users only the
+watchers they are subscribed to.
+*/
+func canSee(user *model.User, w *model.Watcher) bool {
+	return user.Admin || watcher.IsSubscribed(w, user.Name)
+}
+
+/*
+scopeQuery limits the query to the watchers the user is subscribed to, unless the user is an admin.
+*/
+func scopeQuery(user *model.User, query *watcher.Query) {
+	if !user.Admin {
+		query.Subscriber = user.Name
+	}
+}
+
+/*
+createWatcher creates the watcher for the user, or subscribes the user to the existing watcher of its URL. The name,
+tags and alert rules of a user with a name are kept in its subscription. Returns the stored watcher and if it is new,
+fails with watcher.ErrDuplicateURL when the user already watches the URL.
+*/
+func createWatcher(s store.Store, user *model.User, newWatcher *model.Watcher) (*model.Watcher, bool, error) {
+	if user.Name != "" {
+		return watcher.CreateFor(s, user.Name, newWatcher)
+	}
+
+	err := watcher.Create(s, newWatcher)
+	return newWatcher, err == nil, err
+}
+
+/*
+settingsOwner returns the name of the user whose subscription has the settings the user changes, or an empty name for
+admins that change the settings of a watcher they are not subscribed to.
+*/
+func settingsOwner(user *model.User, w *model.Watcher) string {
+	if watcher.IsSubscribed(w, user.Name) {
+		return user.Name
+	}
+
+	return ""
+}
+
+/*
+present changes the watcher into the watcher as the user sees it, with the settings of the subscription of the user.
+Only admins see the subscriptions of the other users.
+*/
+func present(user *model.User, w *model.Watcher) {
+	watcher.Personalize(w, user.Name)
+
+	if !user.Admin {
+		w.Subscribers = nil
+	}
+}
+
+/*
+removeWatcher unsubscribes the user from the watcher with the given ID, the watcher is removed when it has no other
+subscribers. Admins remove the watchers they are not subscribed to for everybody. Fails with watcher.ErrNotFound when
+the user can not see the watcher.
+*/
+func removeWatcher(s store.Store, user *model.User, id int) error {
+	found, err := watcher.Get(s, id)
+	if err != nil {
+		return err
+	}
+
+	if watcher.IsSubscribed(found, user.Name) {
+		return watcher.Unsubscribe(s, id, user.Name)
+	}
+
+	if !user.Admin {
+		return watcher.ErrNotFound
+	}
+
+	return watcher.Remove(s, id)
+}
+
+/*
+isWorker checks if the request may use the queue and price routes. The routes are open when no worker.token is
+configured, so the workers that do not send a token keep working. Otherwise the request needs the worker.token, the
+admin.token or the token of an admin user as bearer token.
+*/
+func isWorker(s store.Store, r *http.Request) bool {
+	token := viper.GetString("worker.token")
+	if token == "" {
+		return true
+	}
+
+	if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) == 1 {
+		return true
+	}
+
+	return isAdmin(s, r)
+}
+
+/*
+workerRoute returns the handle for a route of the workers, requests that are not from a worker get 401 Unauthorized.
+*/
+func workerRoute(s store.Store, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !isWorker(s, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pricewatcher"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handle(w, r, p)
+	}
+}
+
+/*
+hasAdminToken checks if the request has the admin.token from the config as bearer token, nobody has it when no token
+is configured.
+*/
+func hasAdminToken(r *http.Request) bool {
+	token := viper.GetString("admin.token")
+	if token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) == 1
+}
+
+/*
+bearerToken returns the bearer token of the Authorization header of the request.
+*/
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
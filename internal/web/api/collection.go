@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+)
+
+/*
+RegisterCollectionHandler registers the v2 routes for the tags and the collections, a collection is a named group of
+the watchers that have one of its tags.
+*/
+func RegisterCollectionHandler(router *httprouter.Router, s store.Store) {
+	h := &collectionHandler{store: s, watchers: &watcherHandlerV2{store: s}}
+
+	router.GET("/v2/tags", h.ListTags)
+	router.GET("/v2/tags/:tag/watchers", h.ListTagged)
+	router.GET("/v2/collections", h.List)
+	router.GET("/v2/collections/:name", h.Get)
+	router.PUT("/v2/collections/:name", h.Save)
+	router.DELETE("/v2/collections/:name", h.Delete)
+	router.GET("/v2/collections/:name/watchers", h.ListWatchers)
+}
+
+// collectionHandler handles the tag and collection routes with the watchers in the store, the watchers are listed by
+// the v2 watcher handler.
+type collectionHandler struct {
+	store    store.Store
+	watchers *watcherHandlerV2
+}
+
+/*
+ListTags returns all the tags with the amount of watchers that have them, users only count the watchers they are
+subscribed to.
+*/
+func (h *collectionHandler) ListTags(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	subscriber := ""
+	if !user.Admin {
+		subscriber = user.Name
+	}
+
+	tags, err := watcher.Tags(h.store, subscriber)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	type tagCount struct {
+		Tag      string `json:"tag"`
+		Watchers int    `json:"watchers"`
+	}
+
+	responseModel := struct {
+		Tags []tagCount `json:"tags"`
+	}{[]tagCount{}}
+
+	for _, tag := range tags {
+		responseModel.Tags = append(responseModel.Tags, tagCount{tag.Tag, tag.Watchers})
+	}
+
+	writeJSON(w, http.StatusOK, responseModel)
+}
+
+/*
+ListTagged returns the watchers with the given tag, it takes the same query params as GET /v2/watchers.
+*/
+func (h *collectionHandler) ListTagged(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queryValues := r.URL.Query()
+	queryValues.Add("tag", p.ByName("tag"))
+	r.URL.RawQuery = queryValues.Encode()
+
+	h.watchers.List(w, r, nil)
+}
+
+/*
+List returns all the collections.
+*/
+func (h *collectionHandler) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if _, ok := authorizeV2(h.store, w, r); !ok {
+		return
+	}
+
+	collections, err := watcher.Collections(h.store)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Collections []model.Collection `json:"collections"`
+	}{collections})
+}
+
+/*
+Get returns the collection with the given name.
+*/
+func (h *collectionHandler) Get(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if _, ok := authorizeV2(h.store, w, r); !ok {
+		return
+	}
+
+	collection, err := watcher.Collection(h.store, p.ByName("name"))
+	if err != nil {
+		writeCollectionError(w, p.ByName("name"), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, collection)
+}
+
+/*
+Save creates or replaces the collection with the given name from the JSON body, like {"description": "Chairs for the
+office", "tags": ["office-chairs", "desks"]}. Answers with 201 for a new collection and 200 for a replaced collection.
+The collections are shared by all the users, so only admins can change them.
+*/
+func (h *collectionHandler) Save(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	input := struct {
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+	}{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, errorInvalidJSON, fmt.Sprintf("the body is not valid JSON: %s", err.Error()), "")
+		return
+	}
+
+	if err := watcher.ValidateCollectionName(p.ByName("name")); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "name")
+		return
+	}
+
+	if _, err := watcher.NormalizeTags(input.Tags); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "tags")
+		return
+	}
+
+	collection := &model.Collection{Name: p.ByName("name"), Description: input.Description, Tags: input.Tags}
+
+	created, err := watcher.SaveCollection(h.store, collection)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", fmt.Sprintf("/v2/collections/%s", collection.Name))
+	}
+
+	writeJSON(w, status, collection)
+}
+
+/*
+Delete removes the collection with the given name, the watchers keep their tags. Answers with 204, only admins can
+remove collections.
+*/
+func (h *collectionHandler) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	if err := watcher.RemoveCollection(h.store, p.ByName("name")); err != nil {
+		writeCollectionError(w, p.ByName("name"), err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ListWatchers returns the watchers in the collection with the given name, it takes the same query params as
+GET /v2/watchers.
+*/
+func (h *collectionHandler) ListWatchers(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queryValues := r.URL.Query()
+	queryValues.Set("collection", p.ByName("name"))
+	r.URL.RawQuery = queryValues.Encode()
+
+	h.watchers.List(w, r, nil)
+}
+
+/*
+authorizeAdmin checks if the user of the request is an admin, or writes the error response and returns false.
+*/
+func (h *collectionHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return false
+	}
+
+	if !user.Admin {
+		writeError(w, http.StatusForbidden, errorForbidden, "only admins can change the collections", "")
+		return false
+	}
+
+	return true
+}
+
+/*
+writeCollectionError writes the error response for a collection that could not be found or removed.
+*/
+func writeCollectionError(w http.ResponseWriter, name string, err error) {
+	if err == watcher.ErrCollectionNotFound {
+		writeError(w, http.StatusNotFound, errorNoCollection, fmt.Sprintf("no collection found with name '%s'", name), "")
+		return
+	}
+
+	writeInternalError(w, err)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/events"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/slogger/pkg/slogger"
+)
+
+/*
+RegisterEventHandler registers the event handler.
+*/
+func RegisterEventHandler(router *httprouter.Router, s store.Store) {
+	h := &eventHandler{store: s}
+
+	router.GET("/events", h.StreamEvents)
+}
+
+// eventHandler handles the event route with the users in the store.
+type eventHandler struct {
+	store store.Store
+}
+
+/*
+StreamEvents streams the events as Server-Sent Events. The event types can be filtered with the types query param, for
+example "?types=price_updated,alert_triggered". A reconnecting client receives the events it missed based on the
+Last-Event-ID header or the last_event_id query param. Users only receive the events of the watchers they are
+subscribed to, admins receive all the events.
+*/
+func (h *eventHandler) StreamEvents(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error("response writer does not support flushing")
+		return
+	}
+
+	queryValues := r.URL.Query()
+
+	var types []string
+	for _, v := range queryValues["types"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = queryValues.Get("last_event_id")
+	}
+
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Given last event id '%s' is not valid.", lastEventID), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	subscription, missed := events.Subscribe(types, lastID)
+	defer subscription.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	if _, err := fmt.Fprint(w, "retry: 3000\n\n"); err != nil {
+		slogger.Error(err.Error())
+		return
+	}
+
+	for _, event := range missed {
+		if !canReceive(user, event) {
+			continue
+		}
+
+		if err := writeEvent(w, presentEvent(user, event)); err != nil {
+			slogger.Error(err.Error())
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// The subscription was closed because the client could not keep up, it will reconnect and catch up.
+				return
+			}
+
+			if !canReceive(user, event) {
+				continue
+			}
+
+			if err := writeEvent(w, presentEvent(user, event)); err != nil {
+				slogger.Error(err.Error())
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+/*
+canReceive checks if the event can be streamed to the user, admins receive all the events and other users only the
+events of the watchers they are subscribed to.
+*/
+func canReceive(user *model.User, event events.Event) bool {
+	return user.Admin || event.HasSubscriber(user.Name)
+}
+
+/*
+presentEvent returns the event with the watcher in its data as the user sees it.
+*/
+func presentEvent(user *model.User, event events.Event) events.Event {
+	if w, ok := event.Data.(model.Watcher); ok {
+		present(user, &w)
+		event.Data = w
+	}
+
+	return event
+}
+
+/*
+writeEvent writes a single event in the Server-Sent Events format.
+*/
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(struct {
+		Data      interface{} `json:"data"`
+		Timestamp time.Time   `json:"timestamp"`
+	}{event.Data, event.Timestamp})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -6,29 +6,44 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/queue"
+	"github.com/laetificat/pricewatcher/internal/store"
 	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/slogger/pkg/slogger"
 )
 
 /*
-RegisterPriceHandler registers the price handler.
+RegisterPriceHandler registers the price handler, its route needs the same bearer token as the queue routes.
 */
-func RegisterPriceHandler(router *httprouter.Router) {
-	router.POST("/prices/update/:id", UpdatePrice)
+func RegisterPriceHandler(router *httprouter.Router, s store.Store) {
+	h := &priceHandler{store: s}
+
+	router.POST("/prices/update/:id", workerRoute(s, h.UpdatePrice))
+}
+
+// priceHandler handles the price routes with the watchers in the store.
+type priceHandler struct {
+	store store.Store
 }
 
 /*
 UpdatePrice accepts a JSON encoded update model and uses that to update the watcher model's price in the database.
 */
-func UpdatePrice(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (h *priceHandler) UpdatePrice(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	updateModel := model.Update{}
 	if err := json.NewDecoder(r.Body).Decode(&updateModel); err != nil {
 		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
 		return
 	}
 
-	err := watcher.Update(&updateModel)
+	err := watcher.Update(h.store, &updateModel)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+
+	// Workers that do not acknowledge their leases would otherwise get the same job again after the lease expired.
+	if err := queue.AckWatcher(updateModel.ID); err != nil {
+		slogger.Error(err.Error())
+	}
 }
@@ -1,23 +1,35 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/laetificat/pricewatcher/internal/model"
 	"github.com/laetificat/pricewatcher/internal/queue"
+	"github.com/laetificat/pricewatcher/internal/store"
 	"github.com/laetificat/slogger/pkg/slogger"
+	"github.com/spf13/viper"
 )
 
 /*
-RegisterQueueHandler registers the queue handler.
+RegisterQueueHandler registers the queue handler, its routes need the worker.token from the config, the admin.token or
+the token of an admin user as bearer token.
 */
-func RegisterQueueHandler(router *httprouter.Router) {
-	router.GET("/queues/:name/next", GetNextItem)
-	router.GET("/queues", GetAvailableQueues)
-	router.GET("/queues/:name", GetQueueItems)
-	router.POST("/queues/:name/add", AddQueueItem)
+func RegisterQueueHandler(router *httprouter.Router, s store.Store) {
+	router.GET("/queues/:name/next", workerRoute(s, GetNextItem))
+	router.GET("/queues", workerRoute(s, GetAvailableQueues))
+	router.GET("/queues/:name", workerRoute(s, GetQueueItems))
+	router.POST("/queues/:name/add", workerRoute(s, AddQueueItem))
+	router.POST("/queues/:name/ack/:lease", workerRoute(s, AckItem))
+	router.POST("/queues/:name/nack/:lease", workerRoute(s, NackItem))
+	router.GET("/queues/:name/failed", workerRoute(s, GetFailedItems))
+	router.POST("/queues/:name/failed/:id/requeue", workerRoute(s, RequeueFailedItem))
+	router.DELETE("/queues/:name/failed/:id", workerRoute(s, DiscardFailedItem))
 }
 
 /*
@@ -58,7 +70,7 @@ func GetQueueItems(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 		return
 	}
 
-	watchers, err := queue.Get(queueName)
+	jobs, err := queue.Get(queueName)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
@@ -66,8 +78,8 @@ func GetQueueItems(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	}
 
 	responseModel := struct {
-		Jobs []*model.Watcher `json:"jobs"`
-	}{watchers}
+		Jobs []*model.Job `json:"jobs"`
+	}{jobs}
 
 	responseBody, err := json.Marshal(responseModel)
 	if err != nil {
@@ -88,14 +100,9 @@ func GetQueueItems(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 GetAvailableQueues returns a list of queue names that are registered.
 */
 func GetAvailableQueues(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	var queueNames []string
-	for k := range queue.ListQueues() {
-		queueNames = append(queueNames, k)
-	}
-
 	responseBody := struct {
 		Queues []string `json:"queues"`
-	}{queueNames}
+	}{queue.ListQueues()}
 
 	response, err := json.Marshal(responseBody)
 	if err != nil {
@@ -113,7 +120,10 @@ func GetAvailableQueues(w http.ResponseWriter, r *http.Request, p httprouter.Par
 }
 
 /*
-GetNextItem returns the next item in the queue with the given name, returns nil if none is found.
+GetNextItem returns the next item in the queue with the given name as a lease, returns nil if none is found.
+The lease has to be acknowledged with AckItem before its deadline or the job is queued again.
+With the wait query parameter, for example "?wait=30s", the request blocks until a job is added or the wait time
+passed, the wait time is limited by queue.max_wait.
 */
 func GetNextItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	queueName := p.ByName("name")
@@ -122,14 +132,114 @@ func GetNextItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
-	watcher, err := queue.Next(queueName)
+	wait, err := parseWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		slogger.Info(err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	lease, err := queue.NextWait(ctx, queueName)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	responseBody, err := json.Marshal(lease)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	_, err = w.Write(responseBody)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+}
+
+/*
+AckItem acknowledges that the job of the given lease was processed successfully.
+*/
+func AckItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	finishLease(w, p, queue.Ack)
+}
+
+/*
+NackItem reports that the job of the given lease failed, the job is queued again or moved to the dead-letter queue.
+The worker can optionally send a JSON body with an "error" field that is stored as the last error of the job.
+*/
+func NackItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	requestModel := struct {
+		Error string `json:"error"`
+	}{}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestModel); err != nil {
+			http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
+			return
+		}
+	}
+
+	finishLease(w, p, func(name, leaseID string) error {
+		return queue.Nack(name, leaseID, requestModel.Error)
+	})
+}
+
+/*
+finishLease calls the given function with the queue name and lease ID from the params and writes the matching status.
+*/
+func finishLease(w http.ResponseWriter, p httprouter.Params, fn func(name, leaseID string) error) {
+	queueName := p.ByName("name")
+	leaseID := p.ByName("lease")
+	if queueName == "" || leaseID == "" {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+
+	if err := fn(queueName, leaseID); err != nil {
+		if err == queue.ErrLeaseNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			slogger.Info(err.Error())
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+}
+
+/*
+GetFailedItems returns the jobs in the dead-letter queue of the queue with the given name.
+*/
+func GetFailedItems(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queueName := p.ByName("name")
+
+	if queueName == "" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	jobs, err := queue.Failed(queueName)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
 		return
 	}
 
-	responseBody, err := json.Marshal(watcher)
+	responseModel := struct {
+		Jobs []*model.Job `json:"jobs"`
+	}{jobs}
+
+	responseBody, err := json.Marshal(responseModel)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
@@ -138,8 +248,75 @@ func GetNextItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 	_, err = w.Write(responseBody)
 	if err != nil {
+		slogger.Error(err.Error())
+	}
+}
+
+/*
+RequeueFailedItem moves the job for the watcher with the given id from the dead-letter queue back to the queue.
+*/
+func RequeueFailedItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	finishFailedItem(w, p, queue.Requeue)
+}
+
+/*
+DiscardFailedItem removes the job for the watcher with the given id from the dead-letter queue.
+*/
+func DiscardFailedItem(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	finishFailedItem(w, p, queue.Discard)
+}
+
+/*
+finishFailedItem calls the given function with the queue name and watcher id from the params and writes the matching
+status.
+*/
+func finishFailedItem(w http.ResponseWriter, p httprouter.Params, fn func(name string, watcherID int) error) {
+	queueName := p.ByName("name")
+	watcherID, err := strconv.Atoi(p.ByName("id"))
+	if queueName == "" || err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if err := fn(queueName, watcherID); err != nil {
+		if err == queue.ErrJobNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			slogger.Info(err.Error())
+			return
+		}
+
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
 		return
 	}
 }
+
+/*
+parseWait parses the wait query parameter as a duration or an amount of seconds, the result is limited to the
+configured maximum wait time.
+*/
+func parseWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, atoiErr := strconv.Atoi(value)
+		if atoiErr != nil {
+			return 0, fmt.Errorf("given wait time '%s' is not a duration", value)
+		}
+
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	if maxWait := viper.GetDuration("queue.max_wait"); wait > maxWait {
+		wait = maxWait
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, nil
+}
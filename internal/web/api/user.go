@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/account"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+)
+
+/*
+RegisterUserHandler registers the v2 routes for the user accounts. The current user can be read by every user, managing
+the users needs the admin.token from the config or the token of an admin user, like the admin routes.
+*/
+func RegisterUserHandler(router *httprouter.Router, s store.Store) {
+	h := &userHandler{store: s}
+
+	router.GET("/v2/user", h.Current)
+	router.GET("/v2/users", h.List)
+	router.POST("/v2/users", h.Create)
+	router.DELETE("/v2/users/:name", h.Delete)
+	router.POST("/v2/users/:name/token", h.ResetToken)
+}
+
+// userHandler handles the user routes with the users in the store.
+type userHandler struct {
+	store store.Store
+}
+
+// userResponse is a user in the responses, without the hash of its token.
+type userResponse struct {
+	Name    string     `json:"name"`
+	Admin   bool       `json:"admin"`
+	Created *time.Time `json:"created,omitempty"`
+	Token   string     `json:"token,omitempty"`
+}
+
+/*
+Current returns the user of the bearer token, an admin without a name for the admin.token or when there are no users.
+*/
+func (h *userHandler) Current(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userFields(user))
+}
+
+/*
+List returns all the users.
+*/
+func (h *userHandler) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	users, err := account.List(h.store)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	responseModel := struct {
+		Users []userResponse `json:"users"`
+	}{[]userResponse{}}
+
+	for i := range users {
+		responseModel.Users = append(responseModel.Users, userFields(&users[i]))
+	}
+
+	writeJSON(w, http.StatusOK, responseModel)
+}
+
+/*
+Create creates a user from the JSON body, like {"name": "alice", "admin": false}. Answers with 201 and the user with its
+token, the token can not be read again afterwards.
+*/
+func (h *userHandler) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	input := struct {
+		Name  string `json:"name"`
+		Admin bool   `json:"admin"`
+	}{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, errorInvalidJSON, fmt.Sprintf("the body is not valid JSON: %s", err.Error()), "")
+		return
+	}
+
+	if err := account.ValidateName(input.Name); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "name")
+		return
+	}
+
+	user, token, err := account.Create(h.store, input.Name, input.Admin)
+	if err != nil {
+		writeUserError(w, input.Name, err)
+		return
+	}
+
+	responseModel := userFields(user)
+	responseModel.Token = token
+
+	writeJSON(w, http.StatusCreated, responseModel)
+}
+
+/*
+Delete removes the user with the given name and unsubscribes it from its watchers, the watchers without other
+subscribers are removed. Answers with 204.
+*/
+func (h *userHandler) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	if _, err := account.Remove(h.store, p.ByName("name")); err != nil {
+		writeUserError(w, p.ByName("name"), err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ResetToken gives the user with the given name a new token and returns it, users can reset their own token.
+*/
+func (h *userHandler) ResetToken(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	if user.Name != p.ByName("name") && !isAdmin(h.store, r) {
+		writeError(w, http.StatusForbidden, errorForbidden, "only admins can reset the token of other users", "")
+		return
+	}
+
+	token, err := account.ResetToken(h.store, p.ByName("name"))
+	if err != nil {
+		writeUserError(w, p.ByName("name"), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userResponse{Name: p.ByName("name"), Token: token})
+}
+
+/*
+authorizeAdmin checks if the request has the admin.token or the token of an admin user, or writes the error response
+and returns false. Unlike the watcher routes the users can not be managed without a token when there are no users.
+*/
+func (h *userHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if isAdmin(h.store, r) {
+		return true
+	}
+
+	if _, err := account.Authenticate(h.store, bearerToken(r)); err == nil {
+		writeError(w, http.StatusForbidden, errorForbidden, "only admins can manage the users", "")
+		return false
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="pricewatcher"`)
+	writeError(w, http.StatusUnauthorized, errorUnauthorized, "the token of an admin is required", "")
+	return false
+}
+
+/*
+writeUserError writes the error response for a user that could not be found, created or changed.
+*/
+func writeUserError(w http.ResponseWriter, name string, err error) {
+	switch err {
+	case account.ErrNotFound:
+		writeError(w, http.StatusNotFound, errorNoUser, fmt.Sprintf("no user found with name '%s'", name), "")
+	case account.ErrExists:
+		writeError(w, http.StatusConflict, errorDuplicateUser, err.Error(), "name")
+	default:
+		writeInternalError(w, err)
+	}
+}
+
+/*
+userFields returns the user without the hash of its token.
+*/
+func userFields(user *model.User) userResponse {
+	response := userResponse{Name: user.Name, Admin: user.Admin}
+	if !user.Created.IsZero() {
+		response.Created = &user.Created
+	}
+
+	return response
+}
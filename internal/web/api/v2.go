@@ -0,0 +1,528 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/laetificat/pricewatcher/internal/helper"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+	"github.com/laetificat/slogger/pkg/slogger"
+)
+
+// The codes of the v2 error responses.
+const (
+	errorInvalidJSON   = "invalid_json"
+	errorInvalidValue  = "invalid_value"
+	errorNotFound      = "watcher_not_found"
+	errorNoCollection  = "collection_not_found"
+	errorDuplicateURL  = "duplicate_url"
+	errorSharedWatcher = "shared_watcher"
+	errorUnauthorized  = "unauthorized"
+	errorForbidden     = "forbidden"
+	errorNoUser        = "user_not_found"
+	errorDuplicateUser = "duplicate_user"
+	errorInternal      = "internal_error"
+)
+
+/*
+RegisterWatcherHandlerV2 registers the v2 watcher handler, a REST API for the watchers that answers with JSON, also for
+errors. The v1 routes of RegisterWatcherHandler keep working next to it.
+*/
+func RegisterWatcherHandlerV2(router *httprouter.Router, s store.Store) {
+	h := &watcherHandlerV2{store: s}
+
+	router.GET("/v2/watchers", h.List)
+	router.POST("/v2/watchers", h.Create)
+	router.GET("/v2/watchers/:id", h.Get)
+	router.PATCH("/v2/watchers/:id", h.Edit)
+	router.DELETE("/v2/watchers/:id", h.Delete)
+	router.POST("/v2/watchers/:id/tags", h.AddTags)
+	router.DELETE("/v2/watchers/:id/tags/:tag", h.RemoveTag)
+}
+
+// watcherHandlerV2 handles the v2 watcher routes with the watchers in the store.
+type watcherHandlerV2 struct {
+	store store.Store
+}
+
+// apiError is the body of all the v2 error responses.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Field   string `json:"field,omitempty"`
+	} `json:"error"`
+}
+
+// watcherInput is the body to create or edit a watcher with, fields that are not given are not changed by an edit.
+type watcherInput struct {
+	Name       *string            `json:"name"`
+	URL        *string            `json:"url"`
+	Domain     *string            `json:"domain"`
+	AlertRules *[]model.AlertRule `json:"alert_rules"`
+	Tags       *[]string          `json:"tags"`
+}
+
+/*
+List returns the watchers that match the query params, see watcher.ParseQuery for the filters, the sort order and the
+pagination. Users only see the watchers they are subscribed to, admins see all the watchers. The price histories are
+only included when the history query param is true, the prices are converted when a currency is given with the
+currency query param.
+*/
+func (h *watcherHandlerV2) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	queryValues := r.URL.Query()
+
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	query, err := watcher.ParseQuery(queryValues)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "")
+		return
+	}
+	scopeQuery(user, &query)
+
+	watchers, next, err := watcher.List(h.store, query)
+	if err != nil {
+		if err == watcher.ErrCollectionNotFound {
+			writeError(w, http.StatusNotFound, errorNoCollection, fmt.Sprintf("no collection found with name '%s'", query.Collection), "")
+			return
+		}
+
+		writeInternalError(w, err)
+		return
+	}
+
+	for i := range watchers {
+		present(user, &watchers[i])
+	}
+
+	if includeHistory, _ := strconv.ParseBool(queryValues.Get("history")); includeHistory {
+		if err := watcher.LoadHistories(h.store, watchers); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if currency := queryValues.Get("currency"); currency != "" {
+		if err := convertWatchers(h.store, watchers, currency); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "currency")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Watchers   []model.Watcher `json:"watchers"`
+		NextCursor string          `json:"next_cursor,omitempty"`
+	}{watchers, next})
+}
+
+/*
+Create creates a watcher from the JSON body, only the url is required. The domain is guessed from the url when it is
+not given. Answers with 201 and the created watcher, or 409 when a watcher already exists for the url. A user that
+creates a watcher for a url that is already watched is subscribed to the existing watcher instead, which is answered
+with 200 and the shared watcher, or 409 when the user is already subscribed to it. The name, alert rules and tags of a
+user are kept in its subscription.
+*/
+func (h *watcherHandlerV2) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := decodeWatcherInput(w, r)
+	if !ok {
+		return
+	}
+
+	if input.URL == nil || *input.URL == "" {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, "the url is required", "url")
+		return
+	}
+
+	changes, ok := validateWatcherInput(w, input, "")
+	if !ok {
+		return
+	}
+
+	newWatcher := &model.Watcher{URL: *changes.URL, Domain: *changes.Domain}
+	if changes.Name != nil {
+		newWatcher.Name = *changes.Name
+	}
+	if changes.AlertRules != nil {
+		newWatcher.AlertRules = *changes.AlertRules
+	}
+	if changes.Tags != nil {
+		newWatcher.Tags = *changes.Tags
+	}
+
+	storedWatcher, created, err := createWatcher(h.store, user, newWatcher)
+	if err != nil {
+		if err == watcher.ErrDuplicateURL {
+			writeError(w, http.StatusConflict, errorDuplicateURL, err.Error(), "url")
+			return
+		}
+
+		writeInternalError(w, err)
+		return
+	}
+
+	present(user, storedWatcher)
+
+	if !created {
+		writeJSON(w, http.StatusOK, storedWatcher)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/watchers/%d", storedWatcher.ID))
+	writeJSON(w, http.StatusCreated, storedWatcher)
+}
+
+/*
+Get returns the watcher with the given id, with its price history when the history query param is true. The prices are
+converted when a currency is given with the currency query param.
+*/
+func (h *watcherHandlerV2) Get(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queryValues := r.URL.Query()
+
+	foundWatcher, user, ok := h.find(w, r, p)
+	if !ok {
+		return
+	}
+
+	present(user, foundWatcher)
+	watchers := []model.Watcher{*foundWatcher}
+
+	if includeHistory, _ := strconv.ParseBool(queryValues.Get("history")); includeHistory {
+		if err := watcher.LoadHistories(h.store, watchers); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if currency := queryValues.Get("currency"); currency != "" {
+		if err := convertWatchers(h.store, watchers, currency); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "currency")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, watchers[0])
+}
+
+/*
+Edit changes the name, url, domain, alert rules and tags of the watcher with the given id that are in the JSON body, the
+price history is kept. The domain is guessed again when the url changes without a domain. The name, alert rules and
+tags of a subscribed user are changed in its subscription, only admins and the only subscriber can change the url and
+domain of a watcher.
+*/
+func (h *watcherHandlerV2) Edit(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	foundWatcher, user, ok := h.find(w, r, p)
+	if !ok {
+		return
+	}
+
+	input, ok := decodeWatcherInput(w, r)
+	if !ok {
+		return
+	}
+
+	if input.URL != nil && *input.URL == "" {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, "the url can not be empty", "url")
+		return
+	}
+
+	changes, ok := validateWatcherInput(w, input, foundWatcher.URL)
+	if !ok {
+		return
+	}
+
+	var editedWatcher *model.Watcher
+	var err error
+	if owner := settingsOwner(user, foundWatcher); owner != "" {
+		editedWatcher, err = watcher.EditSubscription(h.store, foundWatcher.ID, owner, user.Admin, changes)
+	} else {
+		editedWatcher, err = watcher.Edit(h.store, foundWatcher.ID, changes)
+	}
+	if err != nil {
+		switch err {
+		case watcher.ErrNotFound:
+			writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id %d", foundWatcher.ID), "")
+		case watcher.ErrDuplicateURL:
+			writeError(w, http.StatusConflict, errorDuplicateURL, err.Error(), "url")
+		case watcher.ErrSharedWatcher:
+			writeError(w, http.StatusConflict, errorSharedWatcher, err.Error(), "url")
+		default:
+			writeInternalError(w, err)
+		}
+		return
+	}
+
+	present(user, editedWatcher)
+	writeJSON(w, http.StatusOK, editedWatcher)
+}
+
+/*
+Delete removes the watcher with the given id and its price history, answers with 204. Users are unsubscribed from the
+watcher, it is only removed when no other users are subscribed to it.
+*/
+func (h *watcherHandlerV2) Delete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	iID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id '%s'", p.ByName("id")), "")
+		return
+	}
+
+	if err := removeWatcher(h.store, user, iID); err != nil {
+		if err == watcher.ErrNotFound {
+			writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id %d", iID), "")
+			return
+		}
+
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+AddTags adds the tags in the JSON body, like {"tags": ["office-chairs"]}, to the watcher with the given id and returns
+the watcher. The tags of a subscribed user are added to its subscription.
+*/
+func (h *watcherHandlerV2) AddTags(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	foundWatcher, user, ok := h.find(w, r, p)
+	if !ok {
+		return
+	}
+
+	input := struct {
+		Tags []string `json:"tags"`
+	}{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, errorInvalidJSON, fmt.Sprintf("the body is not valid JSON: %s", err.Error()), "")
+		return
+	}
+
+	if _, err := watcher.NormalizeTags(input.Tags); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "tags")
+		return
+	}
+
+	changedWatcher, err := watcher.AddTags(h.store, foundWatcher.ID, settingsOwner(user, foundWatcher), input.Tags)
+	if err != nil {
+		h.writeChangeError(w, foundWatcher.ID, err)
+		return
+	}
+
+	present(user, changedWatcher)
+	writeJSON(w, http.StatusOK, changedWatcher)
+}
+
+/*
+RemoveTag removes the tag from the watcher with the given id, answers with 204. The tag of a subscribed user is removed
+from its subscription.
+*/
+func (h *watcherHandlerV2) RemoveTag(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	foundWatcher, user, ok := h.find(w, r, p)
+	if !ok {
+		return
+	}
+
+	tags := []string{p.ByName("tag")}
+	if _, err := watcher.NormalizeTags(tags); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "tag")
+		return
+	}
+
+	if _, err := watcher.RemoveTags(h.store, foundWatcher.ID, settingsOwner(user, foundWatcher), tags); err != nil {
+		h.writeChangeError(w, foundWatcher.ID, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+writeChangeError writes the error response for a watcher that could not be changed.
+*/
+func (h *watcherHandlerV2) writeChangeError(w http.ResponseWriter, id int, err error) {
+	if err == watcher.ErrNotFound {
+		writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id %d", id), "")
+		return
+	}
+
+	writeInternalError(w, err)
+}
+
+/*
+find returns the watcher with the id from the route and the user of the request, or writes the error response and
+returns false. The watchers the user can not see are not found.
+*/
+func (h *watcherHandlerV2) find(w http.ResponseWriter, r *http.Request, p httprouter.Params) (*model.Watcher, *model.User, bool) {
+	user, ok := authorizeV2(h.store, w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	iID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id '%s'", p.ByName("id")), "")
+		return nil, nil, false
+	}
+
+	foundWatcher, err := watcher.Get(h.store, iID)
+	if err == nil && !canSee(user, foundWatcher) {
+		err = watcher.ErrNotFound
+	}
+	if err != nil {
+		if err == watcher.ErrNotFound {
+			writeError(w, http.StatusNotFound, errorNotFound, fmt.Sprintf("no watcher found with id %d", iID), "")
+			return nil, nil, false
+		}
+
+		writeInternalError(w, err)
+		return nil, nil, false
+	}
+
+	return foundWatcher, user, true
+}
+
+/*
+decodeWatcherInput decodes the JSON body of the request, or writes the error response and returns false. Unknown fields
+are rejected so typos do not go unnoticed.
+*/
+func decodeWatcherInput(w http.ResponseWriter, r *http.Request) (*watcherInput, bool) {
+	input := &watcherInput{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(input); err != nil {
+		writeError(w, http.StatusBadRequest, errorInvalidJSON, fmt.Sprintf("the body is not valid JSON: %s", err.Error()), "")
+		return nil, false
+	}
+
+	return input, true
+}
+
+/*
+validateWatcherInput checks the input and returns it as changes, or writes the error response and returns false. The
+domain is resolved when the url changes, currentURL is the url of the watcher that is edited.
+*/
+func validateWatcherInput(w http.ResponseWriter, input *watcherInput, currentURL string) (watcher.Changes, bool) {
+	changes := watcher.Changes{Name: input.Name, URL: input.URL, AlertRules: input.AlertRules}
+
+	if input.Tags != nil {
+		tags, err := watcher.NormalizeTags(*input.Tags)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "tags")
+			return changes, false
+		}
+		changes.Tags = &tags
+	}
+
+	if input.AlertRules != nil {
+		for _, rule := range *input.AlertRules {
+			if err := watcher.ValidateAlertRule(rule); err != nil {
+				writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "alert_rules")
+				return changes, false
+			}
+		}
+	}
+
+	if input.URL != nil || input.Domain != nil {
+		pageURL := currentURL
+		if input.URL != nil {
+			pageURL = *input.URL
+		}
+
+		givenDomain := ""
+		if input.Domain != nil {
+			givenDomain = *input.Domain
+		}
+
+		domain, err := helper.ResolveDomain(pageURL, givenDomain)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, errorInvalidValue, err.Error(), "domain")
+			return changes, false
+		}
+		changes.Domain = &domain
+	}
+
+	return changes, true
+}
+
+/*
+writeJSON writes the value as JSON response with the given status.
+*/
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(body); err != nil {
+		slogger.Error(err.Error())
+	}
+}
+
+/*
+writeError writes a v2 error response, field is the input field that caused the error and can be empty.
+*/
+func writeError(w http.ResponseWriter, status int, code, message, field string) {
+	if status < http.StatusInternalServerError {
+		slogger.Info(message)
+	}
+
+	response := apiError{}
+	response.Error.Code = code
+	response.Error.Message = message
+	response.Error.Field = field
+
+	writeJSON(w, status, response)
+}
+
+/*
+writeInternalError logs the error and writes a v2 error response without the details of the error.
+*/
+func writeInternalError(w http.ResponseWriter, err error) {
+	slogger.Error(err.Error())
+
+	response := apiError{}
+	response.Error.Code = errorInternal
+	response.Error.Message = http.StatusText(http.StatusInternalServerError)
+
+	body, _ := json.Marshal(response)
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if _, err := w.Write(body); err != nil {
+		slogger.Error(err.Error())
+	}
+}
@@ -4,52 +4,133 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/laetificat/pricewatcher/internal/helper"
 	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/rates"
+	"github.com/laetificat/pricewatcher/internal/store"
 	"github.com/laetificat/pricewatcher/internal/watcher"
 	"github.com/laetificat/slogger/pkg/slogger"
 )
 
 /*
 RegisterWatcherHandler registers the watcher handler.
+
+The router does not allow a static path segment and a parameter at the same position, so the routes that share their
+position with the watcher id are dispatched by routeWatcher and routeWatcherAction.
 */
-func RegisterWatcherHandler(router *httprouter.Router) {
-	router.GET("/watchers", ListAll)
-	router.GET("/watchers/run/:id", RunAll)
-	router.GET("/watchers/delete/:id", DeleteOne)
-	router.GET("/watchers/create", AddOne)
+func RegisterWatcherHandler(router *httprouter.Router, s store.Store) {
+	h := &watcherHandler{store: s}
+
+	router.GET("/watchers", h.ListAll)
+	router.GET("/watchers/:id", h.routeWatcher)
+	router.GET("/watchers/:id/:action", h.routeWatcherAction)
+}
+
+// watcherHandler handles the watcher routes with the watchers in the store.
+type watcherHandler struct {
+	store store.Store
 }
 
 /*
-ListAll returns a list of all the watchers, filters the list by url or domain if given as query params.
+routeWatcher dispatches /watchers/create, /watchers/run and /watchers/:id.
 */
-func ListAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	queryValues := r.URL.Query()
+func (h *watcherHandler) routeWatcher(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	switch p.ByName("id") {
+	case "create":
+		h.AddOne(w, r, p)
+	case "run":
+		h.RunAll(w, r, httprouter.Params{})
+	default:
+		h.GetOne(w, r, p)
+	}
+}
 
-	queryKeys := map[string]string{}
+/*
+routeWatcherAction dispatches /watchers/run/:id, /watchers/delete/:id, /watchers/:id/alerts and /watchers/:id/prices.
+*/
+func (h *watcherHandler) routeWatcherAction(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	idParams := httprouter.Params{{Key: "id", Value: p.ByName("action")}}
 
-	if urlParam := queryValues.Get("url"); urlParam != "" {
-		queryKeys["Url"] = urlParam
+	switch p.ByName("id") {
+	case "run":
+		h.RunAll(w, r, idParams)
+		return
+	case "delete":
+		h.DeleteOne(w, r, idParams)
+		return
 	}
 
-	if domainParam := queryValues.Get("domain"); domainParam != "" {
-		queryKeys["Domain"] = domainParam
+	switch p.ByName("action") {
+	case "alerts":
+		h.ListAlerts(w, r, httprouter.Params{{Key: "id", Value: p.ByName("id")}})
+	case "prices":
+		h.ListPrices(w, r, httprouter.Params{{Key: "id", Value: p.ByName("id")}})
+	default:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 	}
+}
 
-	var priceHistories []model.Watcher
-	var err error
+/*
+ListAll returns a list of the watchers that match the query params, see watcher.ParseQuery for the filters, the sort
+order and the pagination. Users only see the watchers they are subscribed to, admins see all the watchers and can
+filter them by subscriber with the user query param. The cursor of the next page is sent in the X-Next-Cursor header.
+The price histories are only included when the history query param is true, the prices are converted when a currency
+is given with the currency query param.
+*/
+func (h *watcherHandler) ListAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	queryValues := r.URL.Query()
+
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
 
-	priceHistories, err = watcher.List(queryKeys)
+	query, err := watcher.ParseQuery(queryValues)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		slogger.Info(err.Error())
+		return
+	}
+	scopeQuery(user, &query)
 
+	priceHistories, next, err := watcher.List(h.store, query)
 	if err != nil {
+		if err == watcher.ErrCollectionNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			slogger.Info(err.Error())
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
 		return
 	}
 
+	for i := range priceHistories {
+		present(user, &priceHistories[i])
+	}
+
+	if includeHistory, _ := strconv.ParseBool(queryValues.Get("history")); includeHistory {
+		if err := watcher.LoadHistories(h.store, priceHistories); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			slogger.Error(err.Error())
+			return
+		}
+	}
+
+	if currency := queryValues.Get("currency"); currency != "" {
+		if err := convertWatchers(h.store, priceHistories, currency); err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
+			return
+		}
+	}
+
 	jbody, err := json.Marshal(priceHistories)
 	if err != nil {
 		slogger.Error(err.Error())
@@ -59,6 +140,10 @@ func ListAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
+	if next != "" {
+		header.Set("X-Next-Cursor", next)
+		header.Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+	}
 
 	_, err = w.Write(jbody)
 	if err != nil {
@@ -66,20 +151,91 @@ func ListAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 }
 
+/*
+GetOne returns the watcher with the given id. The price history is only included when the history query param is true,
+the prices are converted when a currency is given with the currency query param.
+*/
+func (h *watcherHandler) GetOne(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queryValues := r.URL.Query()
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	foundWatcher, ok := h.find(w, user, p.ByName("id"))
+	if !ok {
+		return
+	}
+
+	watchers := []model.Watcher{*foundWatcher}
+
+	if includeHistory, _ := strconv.ParseBool(queryValues.Get("history")); includeHistory {
+		if err := watcher.LoadHistories(h.store, watchers); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			slogger.Error(err.Error())
+			return
+		}
+	}
+
+	if currency := queryValues.Get("currency"); currency != "" {
+		if err := convertWatchers(h.store, watchers, currency); err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
+			return
+		}
+	}
+
+	responseBody, err := json.Marshal(watchers[0])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	_, err = w.Write(responseBody)
+	if err != nil {
+		slogger.Error(err.Error())
+	}
+}
+
 /*
 RunAll registers all the jobs for the watchers in all the queues, if given an id it will only register watchers for the
-queue with the given id.
+queue with the given id. Without an id only the watchers that match the query params are registered, see
+watcher.ParseQuery, for example /watchers/run?tag=black-friday. Users only run the watchers they are subscribed to.
 */
-func RunAll(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func (h *watcherHandler) RunAll(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	ParamsID := p.ByName("id")
 
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
 
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
 	if ParamsID == "" {
-		err := watcher.RunAll()
+		query, err := watcher.ParseQuery(r.URL.Query())
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
+			return
+		}
+		scopeQuery(user, &query)
+
+		err = watcher.RunAll(h.store, query)
+		if err != nil {
+			if err == watcher.ErrCollectionNotFound {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				slogger.Info(err.Error())
+				return
+			}
+
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			slogger.Error(err.Error())
 			return
@@ -88,16 +244,14 @@ func RunAll(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
-	iID, err := strconv.Atoi(ParamsID)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		slogger.Error(err.Error())
+	foundWatcher, ok := h.find(w, user, ParamsID)
+	if !ok {
 		return
 	}
 
-	err = watcher.Run(iID)
+	err := watcher.Run(h.store, foundWatcher.ID)
 	if err != nil {
-		if strings.EqualFold(err.Error(), "key not found") {
+		if err == watcher.ErrNotFound {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			slogger.Info(err.Error())
 			return
@@ -110,14 +264,20 @@ func RunAll(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 }
 
 /*
-DeleteOne deleted a single watcher from the database based on given id.
+DeleteOne deleted a single watcher from the database based on given id. Users are unsubscribed from the watcher, it is
+only removed when no other users are subscribed to it.
 */
-func DeleteOne(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func (h *watcherHandler) DeleteOne(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	id := p.ByName("id")
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
 
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
 	if id == "" {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
@@ -130,8 +290,13 @@ func DeleteOne(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		return
 	}
 
-	err = watcher.Remove(iID)
+	err = removeWatcher(h.store, user, iID)
 	if err != nil {
+		if err == watcher.ErrNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		slogger.Error(err.Error())
 	}
@@ -139,36 +304,355 @@ func DeleteOne(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 /*
 AddOne registers a new watcher based on the given query parameters url and domain. It is possible to omit domain as
-this will be added automatically.
+this will be added automatically. Alert rules can be added with the query parameters below, drop_percent, drop_from_low
+and new_low. A user that adds a url that is already watched is subscribed to the existing watcher.
 */
-func AddOne(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (h *watcherHandler) AddOne(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	queryValues := r.URL.Query()
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
 
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
 	givenURL := queryValues.Get("url")
-	givenDomain := queryValues.Get("domain")
 
-	if givenDomain == "" {
-		var err error
-		givenDomain, err = helper.GuessDomain(givenURL)
+	givenDomain, err := helper.ResolveDomain(givenURL, queryValues.Get("domain"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		slogger.Info(err.Error())
+		return
+	}
+
+	alertRules, err := alertRulesFromQuery(queryValues)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		slogger.Info(err.Error())
+		return
+	}
+
+	newWatcher := &model.Watcher{URL: givenURL, Domain: givenDomain, AlertRules: alertRules}
+	if _, _, err := createWatcher(h.store, user, newWatcher); err != nil {
+		if err == watcher.ErrDuplicateURL {
+			http.Error(w, err.Error(), http.StatusConflict)
+			slogger.Info(err.Error())
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+}
+
+/*
+ListAlerts returns the alert rules and the triggered alerts of the watcher with the given id, the prices of the alerts
+are converted when a currency is given with the currency query param.
+*/
+func (h *watcherHandler) ListAlerts(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	foundWatcher, ok := h.find(w, user, p.ByName("id"))
+	if !ok {
+		return
+	}
+
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		table, err := rates.Load(h.store)
+		if err == nil {
+			err = table.ConvertWatcher(foundWatcher, currency)
+		}
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			slogger.Error(err.Error())
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
 			return
 		}
 	}
 
-	if helper.IsSupported(givenDomain) {
-		if err := watcher.Add(givenDomain, givenURL); err != nil {
+	responseModel := struct {
+		Rules  []model.AlertRule `json:"rules"`
+		Alerts []model.Alert     `json:"alerts"`
+	}{foundWatcher.AlertRules, foundWatcher.Alerts}
+
+	responseBody, err := json.Marshal(responseModel)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	_, err = w.Write(responseBody)
+	if err != nil {
+		slogger.Error(err.Error())
+	}
+}
+
+/*
+ListPrices returns the price history of the watcher with the given id with its statistics. The from and to query params
+limit the history to a time range, as RFC 3339 time or as date, and the bucket query param downsamples the history into
+buckets like 6h, 1d or 1w. The prices are converted when a currency is given with the currency query param, otherwise
+the buckets and statistics only use the prices in the currency of the last price.
+*/
+func (h *watcherHandler) ListPrices(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	queryValues := r.URL.Query()
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	user, ok := authorize(h.store, w, r)
+	if !ok {
+		return
+	}
+
+	from, to, bucket, err := priceQuery(queryValues)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		slogger.Info(err.Error())
+		return
+	}
+
+	foundWatcher, ok := h.find(w, user, p.ByName("id"))
+	if !ok {
+		return
+	}
+	iID := foundWatcher.ID
+
+	prices, err := watcher.History(h.store, iID, from, to)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	// The all-time statistics need the full history, it is only read again when the prices are limited to a range.
+	history := prices
+	ranged := !from.IsZero() || !to.IsZero()
+	if ranged {
+		history, err = watcher.History(h.store, iID, time.Time{}, time.Time{})
+		if err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			slogger.Error(err.Error())
 			return
 		}
 	}
 
-	errorTxt := fmt.Sprintf("Given domain '%s' is not supported.", givenDomain)
-	slogger.Info(errorTxt)
-	http.Error(w, errorTxt, http.StatusNotAcceptable)
+	if currency := queryValues.Get("currency"); currency != "" {
+		err := convertPrices(h.store, prices, currency)
+		if err == nil && ranged {
+			err = convertPrices(h.store, history, currency)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			slogger.Info(err.Error())
+			return
+		}
+	}
+
+	responseModel := struct {
+		ID      int                 `json:"id"`
+		Prices  []model.Price       `json:"prices,omitempty"`
+		Buckets []model.PriceBucket `json:"buckets,omitempty"`
+		Stats   model.PriceStats    `json:"stats"`
+	}{ID: iID, Stats: watcher.Statistics(history, prices, time.Now())}
+
+	if bucket > 0 {
+		responseModel.Buckets = watcher.Downsample(prices, bucket)
+	} else {
+		responseModel.Prices = prices
+	}
+
+	responseBody, err := json.Marshal(responseModel)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return
+	}
+
+	_, err = w.Write(responseBody)
+	if err != nil {
+		slogger.Error(err.Error())
+	}
+}
+
+/*
+find returns the watcher with the given id as the user sees it when the user can see it, or writes the error response
+and returns false. The watchers the user can not see are not found.
+*/
+func (h *watcherHandler) find(w http.ResponseWriter, user *model.User, id string) (*model.Watcher, bool) {
+	iID, err := strconv.Atoi(id)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+
+	foundWatcher, err := watcher.Get(h.store, iID)
+	if err != nil {
+		if err == watcher.ErrNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return nil, false
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		slogger.Error(err.Error())
+		return nil, false
+	}
+
+	if !canSee(user, foundWatcher) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+
+	present(user, foundWatcher)
+	return foundWatcher, true
+}
+
+/*
+alertRulesFromQuery returns the alert rules for the alert query parameters that are set.
+*/
+func alertRulesFromQuery(queryValues url.Values) ([]model.AlertRule, error) {
+	var alertRules []model.AlertRule
+
+	if queryValues.Get(model.AlertBelow) != "" {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertBelow, Amount: queryValues.Get(model.AlertBelow)})
+	}
+
+	for _, param := range []string{model.AlertDropPercent, model.AlertDropFromLow} {
+		if queryValues.Get(param) == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(queryValues.Get(param), 32)
+		if err != nil {
+			return nil, fmt.Errorf("given value '%s' for '%s' is not a number", queryValues.Get(param), param)
+		}
+
+		alertRules = append(alertRules, model.AlertRule{Type: param, Value: float32(value)})
+	}
+
+	if newLow, _ := strconv.ParseBool(queryValues.Get("new_low")); newLow {
+		alertRules = append(alertRules, model.AlertRule{Type: model.AlertNewLow})
+	}
+
+	for _, rule := range alertRules {
+		if err := watcher.ValidateAlertRule(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return alertRules, nil
+}
+
+/*
+convertWatchers converts the prices of the watchers to the given currency with the stored exchange rates.
+*/
+func convertWatchers(storage rates.Storage, watchers []model.Watcher, currency string) error {
+	table, err := rates.Load(storage)
+	if err != nil {
+		return err
+	}
+
+	for i := range watchers {
+		if err := table.ConvertWatcher(&watchers[i], currency); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+convertPrices converts the prices to the given currency with the stored exchange rates.
+*/
+func convertPrices(storage rates.Storage, prices []model.Price, currency string) error {
+	table, err := rates.Load(storage)
+	if err != nil {
+		return err
+	}
+
+	for i := range prices {
+		converted, err := table.Convert(prices[i].Value, currency, prices[i].Timestamp)
+		if err != nil {
+			return err
+		}
+
+		prices[i].Value = converted
+	}
+
+	return nil
+}
+
+/*
+priceQuery returns the time range and the bucket size of the from, to and bucket query params. A date as to includes
+the whole day.
+*/
+func priceQuery(queryValues url.Values) (time.Time, time.Time, time.Duration, error) {
+	var from, to time.Time
+	var bucket time.Duration
+
+	for _, param := range []string{"from", "to"} {
+		value := queryValues.Get(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				return from, to, bucket, fmt.Errorf("given value '%s' for '%s' is not a date or RFC 3339 time", value, param)
+			}
+
+			if param == "to" {
+				t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+		}
+
+		if param == "from" {
+			from = t
+		} else {
+			to = t
+		}
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, bucket, fmt.Errorf("'to' is before 'from'")
+	}
+
+	if value := queryValues.Get("bucket"); value != "" {
+		var err error
+		bucket, err = parseBucket(value)
+		if err != nil || bucket <= 0 {
+			return from, to, bucket, fmt.Errorf("given value '%s' for 'bucket' is not a duration like 6h, 1d or 1w", value)
+		}
+	}
+
+	return from, to, bucket, nil
+}
+
+/*
+parseBucket parses a bucket size, a duration that also supports days and weeks like 1d and 2w.
+*/
+func parseBucket(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+
+	if unit, ok := units[value[len(value)-1:]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(n) * unit, nil
+	}
+
+	return time.ParseDuration(value)
 }
@@ -0,0 +1,4 @@
+/*
+Package worker contains the built-in worker that checks the prices of the jobs in the queues.
+*/
+package worker
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/queue"
+	"github.com/laetificat/pricewatcher/internal/store"
+	"github.com/laetificat/pricewatcher/internal/watcher"
+)
+
+// LocalSource uses the queues and watchers of the current process, it is used when the worker runs in the webserver.
+type LocalSource struct {
+	Store store.Store
+}
+
+/*
+Queues returns the names of the registered queues.
+*/
+func (s *LocalSource) Queues() ([]string, error) {
+	return queue.ListQueues(), nil
+}
+
+/*
+Next waits for the next job in the queue.
+*/
+func (s *LocalSource) Next(ctx context.Context, queueName string, wait time.Duration) (*model.Lease, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	return queue.NextWait(ctx, queueName)
+}
+
+/*
+Ack acknowledges the lease.
+*/
+func (s *LocalSource) Ack(queueName, leaseID string) error {
+	return queue.Ack(queueName, leaseID)
+}
+
+/*
+Nack reports the lease as failed.
+*/
+func (s *LocalSource) Nack(queueName, leaseID, reason string) error {
+	return queue.Nack(queueName, leaseID, reason)
+}
+
+/*
+Update adds the new price to the watcher.
+*/
+func (s *LocalSource) Update(updateModel *model.Update) error {
+	return watcher.Update(s.Store, updateModel)
+}
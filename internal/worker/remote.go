@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/queue"
+)
+
+// errNotFound is returned when the webserver responds with 404.
+var errNotFound = fmt.Errorf("not found")
+
+// HTTPSource uses the API of a running webserver, the Token is sent as bearer token when it is set.
+type HTTPSource struct {
+	Address string
+	Token   string
+	client  *http.Client
+}
+
+/*
+NewHTTPSource returns a source for the webserver on the given address, for example "http://localhost:8080".
+*/
+func NewHTTPSource(address string) *HTTPSource {
+	return &HTTPSource{Address: address, client: &http.Client{}}
+}
+
+/*
+Queues returns the names of the queues of the webserver.
+*/
+func (s *HTTPSource) Queues() ([]string, error) {
+	responseModel := struct {
+		Queues []string `json:"queues"`
+	}{}
+
+	if err := s.do(context.Background(), http.MethodGet, "/queues", nil, &responseModel); err != nil {
+		return nil, err
+	}
+
+	return responseModel.Queues, nil
+}
+
+/*
+Next waits for the next job in the queue with a long-polling request.
+*/
+func (s *HTTPSource) Next(ctx context.Context, queueName string, wait time.Duration) (*model.Lease, error) {
+	var lease *model.Lease
+
+	path := fmt.Sprintf("/queues/%s/next?wait=%s", url.PathEscape(queueName), url.QueryEscape(wait.String()))
+	if err := s.do(ctx, http.MethodGet, path, nil, &lease); err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+/*
+Ack acknowledges the lease, the webserver already acknowledges the lease when it receives the price update so a lease
+that is not found is returned as queue.ErrLeaseNotFound.
+*/
+func (s *HTTPSource) Ack(queueName, leaseID string) error {
+	path := fmt.Sprintf("/queues/%s/ack/%s", url.PathEscape(queueName), url.PathEscape(leaseID))
+
+	err := s.do(context.Background(), http.MethodPost, path, nil, nil)
+	if err == errNotFound {
+		return queue.ErrLeaseNotFound
+	}
+
+	return err
+}
+
+/*
+Nack reports the lease as failed with the given reason.
+*/
+func (s *HTTPSource) Nack(queueName, leaseID, reason string) error {
+	path := fmt.Sprintf("/queues/%s/nack/%s", url.PathEscape(queueName), url.PathEscape(leaseID))
+	body := struct {
+		Error string `json:"error"`
+	}{reason}
+
+	return s.do(context.Background(), http.MethodPost, path, body, nil)
+}
+
+/*
+Update posts the new price of the watcher.
+*/
+func (s *HTTPSource) Update(updateModel *model.Update) error {
+	path := "/prices/update/" + strconv.Itoa(updateModel.ID)
+
+	return s.do(context.Background(), http.MethodPost, path, updateModel, nil)
+}
+
+/*
+do sends a request to the webserver with the body encoded as JSON and decodes the JSON response into the target when
+it is not nil.
+*/
+func (s *HTTPSource) do(ctx context.Context, method, path string, body, target interface{}) error {
+	var requestBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&requestBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, s.Address+path, &requestBody)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if s.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("request %s %s failed, status code %d", method, path, response.StatusCode)
+	}
+
+	if target == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
@@ -0,0 +1,17 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+)
+
+// Source hands out jobs to the worker and receives the results.
+type Source interface {
+	Queues() ([]string, error)
+	Next(ctx context.Context, queueName string, wait time.Duration) (*model.Lease, error)
+	Ack(queueName, leaseID string) error
+	Nack(queueName, leaseID, reason string) error
+	Update(updateModel *model.Update) error
+}
@@ -0,0 +1,277 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/extractor"
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/queue"
+	"github.com/laetificat/slogger/pkg/slogger"
+)
+
+// pollInterval is the minimum time between two requests for a job of a queue without jobs, so a source that does not
+// wait for jobs is not asked in a tight loop.
+const pollInterval = time.Second
+
+// DefaultMaxBodySize is the size in bytes of the largest product page a new worker reads.
+const DefaultMaxBodySize = 5 << 20
+
+// privateNetworks are the address ranges of private networks that are not in the standard library checks.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+// Worker takes jobs from the queues of a source, fetches the product pages and reports the prices back to the source.
+// Product pages on loopback and private addresses are refused unless AllowPrivate is set, the URLs are added by the
+// users of the webserver and the worker should not be used to reach the network it runs in. Product pages larger than
+// MaxBodySize bytes are refused.
+type Worker struct {
+	Source       Source
+	UserAgent    string
+	Wait         time.Duration
+	AllowPrivate bool
+	MaxBodySize  int64
+	client       *http.Client
+}
+
+/*
+New returns a worker for the given source, pages are fetched with the given user agent and timeout.
+*/
+func New(source Source, userAgent string, timeout, wait time.Duration) *Worker {
+	w := &Worker{
+		Source:      source,
+		UserAgent:   userAgent,
+		Wait:        wait,
+		MaxBodySize: DefaultMaxBodySize,
+	}
+
+	// The address is checked when the connection is made, so it also applies to redirects and to host names that
+	// resolve to a private address.
+	dialer := &net.Dialer{Timeout: timeout, Control: w.checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	w.client = &http.Client{Timeout: timeout, Transport: transport}
+
+	return w
+}
+
+/*
+Run processes the jobs of the given queues until the context is done, every queue is processed by its own goroutine.
+All the queues of the source are used when no queues are given.
+*/
+func (w *Worker) Run(ctx context.Context, queueNames []string) error {
+	if len(queueNames) == 0 {
+		var err error
+		queueNames, err = w.Source.Queues()
+		if err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range queueNames {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			w.runQueue(ctx, name)
+		}(name)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+/*
+runQueue processes the jobs of a single queue until the context is done.
+*/
+func (w *Worker) runQueue(ctx context.Context, queueName string) {
+	slogger.Info(fmt.Sprintf("Worker started for queue '%s'", queueName))
+
+	for ctx.Err() == nil {
+		started := time.Now()
+
+		lease, err := w.Source.Next(ctx, queueName, w.Wait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			slogger.Error(fmt.Sprintf("could not get the next job from queue '%s': %s", queueName, err.Error()))
+			if w.Wait > pollInterval {
+				sleep(ctx, w.Wait)
+			} else {
+				sleep(ctx, pollInterval)
+			}
+			continue
+		}
+
+		if lease == nil {
+			// Without a wait, or with a source that does not wait for jobs, the source answers right away.
+			sleep(ctx, pollInterval-time.Since(started))
+			continue
+		}
+
+		w.finish(queueName, lease, w.Process(lease))
+	}
+}
+
+/*
+Process fetches the product page of the job, extracts the product information and reports the new price.
+*/
+func (w *Worker) Process(lease *model.Lease) error {
+	slogger.Debug(fmt.Sprintf("Checking price of watcher %d: %s", lease.ID, lease.URL))
+
+	product, err := w.fetch(lease.Domain, lease.URL)
+	if err != nil {
+		return err
+	}
+
+	return w.Source.Update(&model.Update{
+		ID:           lease.ID,
+		Name:         product.Name,
+		Availability: product.Availability,
+		GTIN:         product.GTIN,
+		Price: model.Price{
+			Value:     product.Price,
+			Timestamp: time.Now(),
+		},
+	})
+}
+
+/*
+fetch requests the product page and extracts the product information with the extractor for the domain, only http and
+https pages up to the maximum body size are fetched.
+*/
+func (w *Worker) fetch(domain, pageURL string) (*extractor.Product, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return nil, fmt.Errorf("can not fetch '%s', only http and https pages are fetched", pageURL)
+	}
+	request.Header.Set("User-Agent", w.UserAgent)
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching '%s' failed, status code %d", pageURL, response.StatusCode)
+	}
+
+	// One byte more than the maximum is read to tell a page of exactly the maximum size from a larger page.
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, w.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > w.MaxBodySize {
+		return nil, fmt.Errorf("fetching '%s' failed, the page is larger than %d bytes", pageURL, w.MaxBodySize)
+	}
+
+	return extractor.Extract(domain, bytes.NewReader(body))
+}
+
+/*
+finish acknowledges the lease when processing succeeded, otherwise it reports the error.
+*/
+func (w *Worker) finish(queueName string, lease *model.Lease, processErr error) {
+	if processErr == nil {
+		if err := w.Source.Ack(queueName, lease.LeaseID); err != nil && err != queue.ErrLeaseNotFound {
+			slogger.Error(fmt.Sprintf("could not acknowledge lease '%s': %s", lease.LeaseID, err.Error()))
+		}
+
+		return
+	}
+
+	slogger.Info(fmt.Sprintf("Checking watcher %d failed: %s", lease.ID, processErr.Error()))
+
+	if err := w.Source.Nack(queueName, lease.LeaseID, processErr.Error()); err != nil {
+		slogger.Error(fmt.Sprintf("could not report lease '%s' as failed: %s", lease.LeaseID, err.Error()))
+	}
+}
+
+/*
+checkAddress refuses connections to loopback, link-local, private and unspecified addresses unless private addresses
+are allowed.
+*/
+func (w *Worker) checkAddress(_, address string, _ syscall.RawConn) error {
+	if w.AllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("can not connect to '%s', it is not an IP address", host)
+	}
+
+	if isPrivate(ip) {
+		return fmt.Errorf("can not connect to '%s', it is a private address", host)
+	}
+
+	return nil
+}
+
+/*
+isPrivate checks if the IP address is a loopback, link-local, private or unspecified address.
+*/
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+mustParseCIDR returns the network of the CIDR notation, it panics for an invalid notation.
+*/
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
+
+/*
+sleep waits for the given duration or until the context is done.
+*/
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
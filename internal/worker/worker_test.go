@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laetificat/pricewatcher/internal/model"
+	"github.com/laetificat/pricewatcher/internal/testutil"
+)
+
+// pages are the saved product pages that are served to the worker.
+var pages = map[string]testutil.Page{
+	"/jsonld": {Body: `<html><head><script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Product", "name": "Kettle", "gtin13": "8712345678906",
+ "offers": {"@type": "Offer", "price": "24.99", "priceCurrency": "EUR", "availability": "https://schema.org/InStock"}}
+</script></head><body><h1>Kettle</h1></body></html>`},
+	"/microdata": {Body: `<html><body><div itemscope itemtype="https://schema.org/Product">
+<h1 itemprop="name">Toaster</h1>
+<span itemprop="price" content="1299.00">€ 1.299,00</span>
+<meta itemprop="priceCurrency" content="EUR">
+<link itemprop="availability" href="https://schema.org/OutOfStock">
+</div></body></html>`},
+	"/bol": {Body: `<html><head><meta itemprop="price" content="19.95"><meta itemprop="priceCurrency" content="EUR"></head>
+<body><h1 data-test="title">Blender</h1></body></html>`},
+	"/coolblue": {Body: `<html><head><meta property="product:price:amount" content="24.99"></head>
+<body><h1 class="js-product-name">Kettle</h1></body></html>`},
+	"/ebay": {Body: `<html><body><h1 class="x-item-title__mainTitle"><span>Toaster</span></h1>
+<div class="x-price-primary">EUR 1.299,00</div></body></html>`},
+	"/no-price": {Body: `<html><body><h1>Nothing for sale</h1></body></html>`},
+	"/redirect": {Location: "/jsonld"},
+}
+
+// testSource is a source that records the updates of the worker.
+type testSource struct {
+	updates []*model.Update
+}
+
+func (s *testSource) Queues() ([]string, error) {
+	return nil, nil
+}
+
+func (s *testSource) Next(ctx context.Context, queueName string, wait time.Duration) (*model.Lease, error) {
+	return nil, nil
+}
+
+func (s *testSource) Ack(queueName, leaseID string) error {
+	return nil
+}
+
+func (s *testSource) Nack(queueName, leaseID, reason string) error {
+	return nil
+}
+
+func (s *testSource) Update(updateModel *model.Update) error {
+	s.updates = append(s.updates, updateModel)
+	return nil
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name         string
+		domain       string
+		path         string
+		url          string
+		allowPrivate bool
+		maxBodySize  int64
+		want         *model.Update
+		wantPrice    string
+		wantErr      string
+	}{
+		{
+			name:         "JSON-LD for a domain without a rule",
+			domain:       "shop.example",
+			path:         "/jsonld",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Kettle", Availability: "InStock", GTIN: "8712345678906"},
+			wantPrice:    "24.99 EUR",
+		},
+		{
+			name:         "microdata for a domain without a rule",
+			domain:       "shop.example",
+			path:         "/microdata",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Toaster", Availability: "OutOfStock"},
+			wantPrice:    "1299.00 EUR",
+		},
+		{
+			name:         "bol.com rule",
+			domain:       "bol.com",
+			path:         "/bol",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Blender"},
+			wantPrice:    "19.95 EUR",
+		},
+		{
+			name:         "coolblue.nl rule",
+			domain:       "coolblue.nl",
+			path:         "/coolblue",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Kettle"},
+			wantPrice:    "24.99 EUR",
+		},
+		{
+			name:         "ebay.nl rule",
+			domain:       "ebay.nl",
+			path:         "/ebay",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Toaster"},
+			wantPrice:    "1299.00 EUR",
+		},
+		{
+			name:         "redirect",
+			domain:       "shop.example",
+			path:         "/redirect",
+			allowPrivate: true,
+			want:         &model.Update{ID: 1, Name: "Kettle", Availability: "InStock", GTIN: "8712345678906"},
+			wantPrice:    "24.99 EUR",
+		},
+		{
+			name:         "page not found",
+			domain:       "shop.example",
+			path:         "/missing",
+			allowPrivate: true,
+			wantErr:      "status code 404",
+		},
+		{
+			name:         "page without a price",
+			domain:       "shop.example",
+			path:         "/no-price",
+			allowPrivate: true,
+			wantErr:      "no price found",
+		},
+		{
+			name:         "page larger than the maximum body size",
+			domain:       "shop.example",
+			path:         "/jsonld",
+			allowPrivate: true,
+			maxBodySize:  64,
+			wantErr:      "the page is larger than 64 bytes",
+		},
+		{
+			name:    "private address",
+			domain:  "shop.example",
+			path:    "/jsonld",
+			wantErr: "it is a private address",
+		},
+		{
+			name:         "not an http page",
+			domain:       "shop.example",
+			url:          "file:///etc/passwd",
+			allowPrivate: true,
+			wantErr:      "only http and https pages are fetched",
+		},
+	}
+
+	server := testutil.ServePages(pages)
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &testSource{}
+			w := New(source, "pricewatcher-test", 5*time.Second, 0)
+			w.AllowPrivate = tt.allowPrivate
+			if tt.maxBodySize > 0 {
+				w.MaxBodySize = tt.maxBodySize
+			}
+
+			pageURL := tt.url
+			if pageURL == "" {
+				pageURL = server.URL + tt.path
+			}
+
+			err := w.Process(&model.Lease{Job: model.Job{Watcher: model.Watcher{ID: 1, URL: pageURL, Domain: tt.domain}}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing '%s', got %v", tt.wantErr, err)
+				}
+
+				if len(source.updates) != 0 {
+					t.Errorf("expected no updates, got %d", len(source.updates))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(source.updates) != 1 {
+				t.Fatalf("expected 1 update, got %d", len(source.updates))
+			}
+
+			got := source.updates[0]
+			if got.ID != tt.want.ID || got.Name != tt.want.Name || got.Availability != tt.want.Availability ||
+				got.GTIN != tt.want.GTIN {
+				t.Errorf("expected update %+v, got %+v", tt.want, got)
+			}
+
+			if price := got.Price.Value.String(); price != tt.wantPrice {
+				t.Errorf("expected price '%s', got '%s'", tt.wantPrice, price)
+			}
+		})
+	}
+}